@@ -0,0 +1,103 @@
+// Package apperrors defines the domain errors shared by services, controllers
+// and middleware. Services wrap failures in one of the sentinel kinds below
+// and the HTTP error handler maps each kind to a status code, so callers never
+// have to inspect error strings.
+package apperrors
+
+import "errors"
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// Error is a domain error whose Message is safe to show to API clients. The
+// optional Err keeps the underlying cause for logs without exposing it.
+type Error struct {
+	Kind    error
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap lets errors.Is match both the sentinel kind and the cause.
+func (e *Error) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+func NotFound(message string) error {
+	return &Error{Kind: ErrNotFound, Message: message}
+}
+
+func Conflict(message string) error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+func Validation(message string) error {
+	return &Error{Kind: ErrValidation, Message: message}
+}
+
+// InvalidFields reports a request that failed validation on one or more
+// fields.
+func InvalidFields(fields []FieldError) error {
+	return &Error{Kind: ErrValidation, Message: "request validation failed", Fields: fields}
+}
+
+func Unauthorized(message string) error {
+	return &Error{Kind: ErrUnauthorized, Message: message}
+}
+
+func Forbidden(message string) error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+// TooManyRequests reports an action the caller has to wait before retrying.
+func TooManyRequests(message string) error {
+	return &Error{Kind: ErrTooManyRequests, Message: message}
+}
+
+// PaymentDeclined reports a payment the gateway refused, keeping the gateway
+// error as the cause.
+func PaymentDeclined(message string, cause error) error {
+	return &Error{Kind: ErrPaymentDeclined, Message: message, Err: cause}
+}
+
+// Fields returns the field-level details of a validation error, if any.
+func Fields(err error) []FieldError {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+// Message returns the client-safe message of a domain error and false for
+// any other error.
+func Message(err error) (string, bool) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Message, true
+	}
+	return "", false
+}
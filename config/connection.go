@@ -2,26 +2,28 @@ package config
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+
 	"github.com/jackc/pgx/v5/pgxpool"
-	"log"
 )
 
 func Connect() (*pgxpool.Pool, error) {
-	connPool, err := pgxpool.NewWithConfig(context.Background(), Config())
+	dbConfig, err := Config()
 	if err != nil {
-		log.Fatal("Error while creating connection to the databse!!")
+		return nil, err
 	}
-	conn, err := connPool.Acquire(context.Background())
+
+	connPool, err := pgxpool.NewWithConfig(context.Background(), dbConfig)
 	if err != nil {
-		log.Fatal("Error while acquiring connection from the database pool!!")
+		return nil, fmt.Errorf("error while creating connection to the database: %w", err)
 	}
-	defer conn.Release()
 
-	err = conn.Ping(context.Background())
-	if err != nil {
-		log.Fatal("Could not ping the database!!")
+	if err := connPool.Ping(context.Background()); err != nil {
+		connPool.Close()
+		return nil, fmt.Errorf("could not ping the database: %w", err)
 	}
-	log.Println("Connected to the database!!")
+	slog.Info("connected to the database")
 
-	return connPool, err
+	return connPool, nil
 }
@@ -1,16 +1,17 @@
 package config
 
 import (
-	"context"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Config() *pgxpool.Config {
+func Config() (*pgxpool.Config, error) {
 	const defaultMaxConns = int32(4)
 	const defaultMinConns = int32(0)
 	const defaultMaxConnLifetime = time.Hour
@@ -18,17 +19,13 @@ func Config() *pgxpool.Config {
 	const defaultHealthCheckPeriod = time.Minute
 	const defaultConnectTimeout = time.Second * 5
 
-	err := godotenv.Load("config/.env")
-	if err != nil {
-		log.Fatal("error loading .env file")
-	}
 	databaseUrl := os.Getenv("PG_DB")
 	if databaseUrl == "" {
-		log.Fatal("PG_DB environment variable not set or is empty")
+		return nil, errors.New("PG_DB environment variable not set or is empty")
 	}
 	dbConfig, err := pgxpool.ParseConfig(databaseUrl)
 	if err != nil {
-		log.Fatal("Failed to create a config, error: ", err)
+		return nil, fmt.Errorf("failed to parse PG_DB: %w", err)
 	}
 
 	dbConfig.MaxConns = defaultMaxConns
@@ -38,19 +35,9 @@ func Config() *pgxpool.Config {
 	dbConfig.HealthCheckPeriod = defaultHealthCheckPeriod
 	dbConfig.ConnConfig.ConnectTimeout = defaultConnectTimeout
 
-	dbConfig.BeforeAcquire = func(ctx context.Context, c *pgx.Conn) bool {
-		log.Println("Before acquiring the connection pool to the database!!")
-		return true
-	}
-
-	dbConfig.AfterRelease = func(c *pgx.Conn) bool {
-		log.Println("After releasing the connection pool to the database!!")
-		return true
-	}
-
 	dbConfig.BeforeClose = func(c *pgx.Conn) {
-		log.Println("Closed the connection pool to the database!!")
+		slog.Debug("closed database connection", slog.Uint64("process.pid", uint64(c.PgConn().PID())))
 	}
 
-	return dbConfig
+	return dbConfig, nil
 }
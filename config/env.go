@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// LoadEnv loads config/.env into the process environment. Variables that are
+// already set take precedence, so the file is optional inside containers.
+func LoadEnv() error {
+	err := godotenv.Load("config/.env")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error loading .env file: %w", err)
+	}
+	return nil
+}
+
+// Getenv returns the value of the environment variable key, or fallback when
+// it is unset or empty.
+func Getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConnectRedis opens a client for the Redis instance at REDIS_URL. It returns
+// a nil client when REDIS_URL is not set so callers can fall back to
+// in-process stores during local development.
+func ConnectRedis() (*redis.Client, error) {
+	redisUrl := os.Getenv("REDIS_URL")
+	if redisUrl == "" {
+		return nil, nil
+	}
+
+	opts, err := redis.ParseURL(redisUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	slog.Info("connected to redis")
+
+	return client, nil
+}
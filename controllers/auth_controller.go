@@ -1,6 +1,11 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -9,88 +14,428 @@ import (
 )
 
 type AuthController struct {
-	DB *pgxpool.Pool
+	DB    *pgxpool.Pool
+	OIDC  services.OIDCProviders
+	SMS   utils.SMSSender
+	Email utils.EmailSender
 }
 
 func (ac *AuthController) RegisterByMail(c *fiber.Ctx) error {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
-	}
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	var input models.RegisterByEmailRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
-	user := models.User{ID: utils.GenerateUniqueID(), Email: input.Email, Password: input.Password, Role: input.Role}
-	token, err := services.RegisterUserByEmail(&user, ac.DB)
+	user := models.User{ID: utils.GenerateUniqueID(), Name: input.Name, Email: input.Email, Password: input.Password, Role: input.Role}
+	tokens, err := services.RegisterUserByEmail(&user, ac.Email, ac.DB)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"token": token})
+	return c.Status(fiber.StatusCreated).JSON(tokens)
 }
 
 func (ac *AuthController) RegisterByPhoneNumber(c *fiber.Ctx) error {
-	var input struct {
-		PhoneNumber string `json:"phone_number"`
-		Password    string `json:"password"`
-		Role        string `json:"role"`
+	var input models.RegisterByPhoneRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+
+	tokens, err := services.RegisterUserByPhoneNumber(input.Name, input.PhoneNumber, input.Password, input.Role, ac.SMS, ac.DB)
+	if err != nil {
+		return err
 	}
 
-	token, err := services.RegisterUserByPhoneNumber(input.PhoneNumber, input.Password, input.Role, ac.DB)
+	return c.Status(fiber.StatusCreated).JSON(tokens)
+}
+
+// Login accepts either an email address or a phone number as identifier.
+func (ac *AuthController) Login(c *fiber.Ctx) error {
+	var input models.LoginRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	result, err := services.LoginUser(input.Identifier, input.Password, loginClient(c), ac.Email, ac.DB)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"token": token})
+	return loginResponse(c, result, input.Cookie)
 }
 
 func (ac *AuthController) LoginByMail(c *fiber.Ctx) error {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	var input models.LoginByEmailRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
 
-	token, err := services.LoginUser(input.Email, input.Password, ac.DB)
+	result, err := services.LoginUser(input.Email, input.Password, loginClient(c), ac.Email, ac.DB)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
+		return err
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"token": token})
+	return loginResponse(c, result, input.Cookie)
 }
 
 func (ac *AuthController) LoginByPhoneNumber(c *fiber.Ctx) error {
-	var input struct {
-		PhoneNumber string `json:"phone_number"`
-		Password    string `json:"password"`
+	var input models.LoginByPhoneRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	result, err := services.LoginUser(input.PhoneNumber, input.Password, loginClient(c), ac.Email, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	return loginResponse(c, result, input.Cookie)
+}
+
+func (ac *AuthController) Refresh(c *fiber.Ctx) error {
+	var input models.RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := middleware.BindBody(c, &input); err != nil {
+			return err
+		}
+	}
+
+	cookie := false
+	if input.RefreshToken == "" {
+		input.RefreshToken = c.Cookies(middleware.RefreshCookie)
+		cookie = true
+	}
+	if input.RefreshToken == "" {
+		return apperrors.Unauthorized("missing refresh token")
+	}
+
+	tokens, err := services.RefreshTokens(input.RefreshToken, ac.DB)
+	if err != nil {
+		if cookie {
+			middleware.ClearSessionCookie(c)
+			middleware.ClearRefreshCookie(c)
+		}
+		return err
+	}
+
+	return tokenResponse(c, tokens, cookie)
+}
+
+func (ac *AuthController) Logout(c *fiber.Ctx) error {
+	var input models.LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := middleware.BindBody(c, &input); err != nil {
+			return err
+		}
+	}
+	if input.RefreshToken == "" {
+		input.RefreshToken = c.Cookies(middleware.RefreshCookie)
+	}
+
+	claims, _ := middleware.GetClaims(c)
+	if err := services.Logout(claims, input.RefreshToken, ac.DB); err != nil {
+		return err
+	}
+
+	middleware.ClearSessionCookie(c)
+	middleware.ClearRefreshCookie(c)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged out successfully"})
+}
+
+// ForgotPasswordByMail always answers 202 so callers cannot tell whether an
+// account exists for the address.
+func (ac *AuthController) ForgotPasswordByMail(c *fiber.Ctx) error {
+	var input models.ForgotPasswordByEmailRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	if err := services.RequestPasswordReset(services.VerificationEmail, input.Email, ac.SMS, ac.Email, ac.DB); err != nil {
+		return err
 	}
-	if err := c.BodyParser(&input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If an account exists for this address, a reset token has been sent"})
+}
+
+func (ac *AuthController) ForgotPasswordByPhoneNumber(c *fiber.Ctx) error {
+	var input models.ForgotPasswordByPhoneRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	if err := services.RequestPasswordReset(services.VerificationPhone, input.PhoneNumber, ac.SMS, ac.Email, ac.DB); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If an account exists for this number, a reset token has been sent"})
+}
+
+func (ac *AuthController) ResetPassword(c *fiber.Ctx) error {
+	var input models.ResetPasswordRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
 
-	token, err := services.LoginUser(input.PhoneNumber, input.Password, ac.DB)
+	if err := services.ResetPassword(input.Token, input.NewPassword, ac.DB); err != nil {
+		return err
+	}
+
+	middleware.ClearSessionCookie(c)
+	middleware.ClearRefreshCookie(c)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password reset successfully, please sign in again"})
+}
+
+// ChangePassword signs out every other session. Browser sessions get new
+// cookies, token clients a new token pair.
+func (ac *AuthController) ChangePassword(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.ChangePasswordRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	tokens, err := services.ChangePassword(claims, input.CurrentPassword, input.NewPassword, ac.DB)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
+		return err
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"token": token})
+	_, bearer := middleware.BearerToken(c)
+	return tokenResponse(c, tokens, !bearer)
+}
+
+// VerifyMFA completes a sign-in that returned an MFA challenge.
+func (ac *AuthController) VerifyMFA(c *fiber.Ctx) error {
+	var input models.VerifyMFARequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	tokens, err := services.VerifyMFAChallenge(input.MFAToken, input.Code, loginClient(c), ac.Email, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	return tokenResponse(c, tokens, input.Cookie)
+}
+
+// EnrollMFA starts TOTP enrollment and returns the secret to add to an
+// authenticator app.
+func (ac *AuthController) EnrollMFA(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+
+	enrollment, err := services.BeginMFAEnrollment(claims, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(enrollment)
+}
+
+// ConfirmMFA enables TOTP and replaces the caller's session with one marked
+// as established with a second factor. Recovery codes are shown only here.
+func (ac *AuthController) ConfirmMFA(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.MFACodeRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	recoveryCodes, tokens, err := services.ConfirmMFAEnrollment(claims, input.Code, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	if _, bearer := middleware.BearerToken(c); bearer {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"recovery_codes": recoveryCodes, "tokens": tokens})
+	}
+	middleware.SetSessionCookie(c, tokens.AccessToken, tokens.ExpiresAt)
+	middleware.SetRefreshCookie(c, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"recovery_codes": recoveryCodes})
+}
+
+func (ac *AuthController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.MFACodeRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	recoveryCodes, err := services.RegenerateRecoveryCodes(claims, input.Code, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"recovery_codes": recoveryCodes})
+}
+
+func (ac *AuthController) DisableMFA(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.MFACodeRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	if err := services.DisableMFA(claims, input.Code, ac.DB); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// SendVerificationCode sends a new one-time code to the caller's email
+// address or phone number.
+func (ac *AuthController) SendVerificationCode(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.SendVerificationRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	if err := services.SendVerificationCode(claims.UserID, input.Channel, ac.SMS, ac.Email, ac.DB); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Verification code sent"})
+}
+
+func (ac *AuthController) Verify(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.VerifyRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	if err := services.VerifyCode(claims.UserID, input.Channel, input.Code, ac.DB); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Verification successful"})
+}
+
+// OIDCLogin redirects the user to the identity provider to sign in.
+func (ac *AuthController) OIDCLogin(c *fiber.Ctx) error {
+	provider, err := ac.oidcProvider(c)
+	if err != nil {
+		return err
+	}
+	var query models.OIDCLoginQuery
+	if err := middleware.BindQuery(c, &query); err != nil {
+		return err
+	}
+
+	state, authURL, err := services.BeginOIDCLogin(provider, query.Role, query.Cookie, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	middleware.SetOIDCStateCookie(c, state, time.Now().Add(services.OIDCLoginTTL))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback completes a login when the identity provider redirects back.
+func (ac *AuthController) OIDCCallback(c *fiber.Ctx) error {
+	provider, err := ac.oidcProvider(c)
+	if err != nil {
+		return err
+	}
+	var query models.OIDCCallbackQuery
+	if err := middleware.BindQuery(c, &query); err != nil {
+		return err
+	}
+
+	// The state must come back to the browser that started the login.
+	state := c.Cookies(middleware.OIDCStateCookie)
+	middleware.ClearOIDCStateCookie(c)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.State)) != 1 {
+		return apperrors.Unauthorized("login state mismatch")
+	}
+	if query.Error != "" {
+		return apperrors.Unauthorized("sign-in was not completed: " + query.Error)
+	}
+	if query.Code == "" {
+		return apperrors.InvalidFields([]apperrors.FieldError{{Field: "code", Message: "is required"}})
+	}
+
+	result, cookie, err := services.CompleteOIDCLogin(provider, query.State, query.Code, loginClient(c), ac.Email, ac.DB)
+	if err != nil {
+		return err
+	}
+
+	return loginResponse(c, result, cookie)
+}
+
+func (ac *AuthController) oidcProvider(c *fiber.Ctx) (services.OIDCProvider, error) {
+	var params models.OIDCProviderParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return nil, err
+	}
+	provider, ok := ac.OIDC[params.Provider]
+	if !ok {
+		return nil, apperrors.NotFound("unknown identity provider")
+	}
+	return provider, nil
+}
+
+func loginClient(c *fiber.Ctx) services.LoginClient {
+	return services.LoginClient{IP: middleware.ClientIP(c), UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
+
+// loginResponse answers a sign-in with either its tokens or the MFA
+// challenge that has to be passed first.
+func loginResponse(c *fiber.Ctx, result *models.LoginResult, cookie bool) error {
+	if result.Challenge != nil {
+		return c.Status(fiber.StatusOK).JSON(result.Challenge)
+	}
+	return tokenResponse(c, result.Tokens, cookie)
+}
+
+// tokenResponse returns the tokens in the body, or keeps them in cookies for
+// browser sessions.
+func tokenResponse(c *fiber.Ctx, tokens *models.TokenPair, cookie bool) error {
+	if !cookie {
+		return c.Status(fiber.StatusOK).JSON(tokens)
+	}
+
+	middleware.SetSessionCookie(c, tokens.AccessToken, tokens.ExpiresAt)
+	middleware.SetRefreshCookie(c, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	})
 }
 
 func (ac *AuthController) ValidateToken(c *fiber.Ctx) error {
-	tokenString := c.Get("Authorization")
-	if tokenString == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "missing token"})
+	tokenString, ok := middleware.BearerToken(c)
+	if !ok {
+		tokenString, ok = middleware.SessionToken(c)
+	}
+	if !ok {
+		return apperrors.Unauthorized("missing token")
 	}
 
-	claims, err := services.ParseJWT(tokenString)
+	claims, err := services.ParseJWT(tokenString, ac.DB)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"claims": claims})
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// unusedProvider fails the test if the callback gets as far as the provider.
+type unusedProvider struct{ t *testing.T }
+
+func (p unusedProvider) Name() string { return "mock" }
+
+func (p unusedProvider) AuthCodeURL(context.Context, string, string, string) (string, error) {
+	p.t.Error("AuthCodeURL called")
+	return "", errors.New("unexpected call")
+}
+
+func (p unusedProvider) Exchange(context.Context, string, string, string) (*services.OIDCIdentity, error) {
+	p.t.Error("Exchange called")
+	return nil, errors.New("unexpected call")
+}
+
+// TestOIDCCallbackRejectsBeforeCompletingLogin covers the checks that run
+// before the login state is looked up, so no database is needed.
+func TestOIDCCallbackRejectsBeforeCompletingLogin(t *testing.T) {
+	controller := AuthController{OIDC: services.OIDCProviders{"mock": unusedProvider{t}}}
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Get("/auth/oidc/:provider/callback", controller.OIDCCallback)
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie string
+		want   int
+	}{
+		{"missing state cookie", "/auth/oidc/mock/callback?state=abc&code=xyz", "", fiber.StatusUnauthorized},
+		{"state mismatch", "/auth/oidc/mock/callback?state=abc&code=xyz", "other", fiber.StatusUnauthorized},
+		{"missing state", "/auth/oidc/mock/callback?code=xyz", "abc", fiber.StatusBadRequest},
+		{"provider error", "/auth/oidc/mock/callback?state=abc&error=access_denied", "abc", fiber.StatusUnauthorized},
+		{"missing code", "/auth/oidc/mock/callback?state=abc", "abc", fiber.StatusBadRequest},
+		{"unknown provider", "/auth/oidc/other/callback?state=abc&code=xyz", "abc", fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, tt.path, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: middleware.OIDCStateCookie, Value: tt.cookie})
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
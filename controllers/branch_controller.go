@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -13,77 +14,82 @@ type BranchController struct {
 }
 
 func (bc *BranchController) AddBranch(c *fiber.Ctx) error {
-	var branch models.Branch
-	if err := c.BodyParser(&branch); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	input, err := middleware.BoundBody[models.AddBranchRequest](c)
+	if err != nil {
+		return err
 	}
 
-	branch.ID = utils.GenerateUniqueID()
-	err := services.AddBranch(&branch, bc.DB)
+	branch := models.Branch{
+		ID:         utils.GenerateUniqueID(),
+		BusinessID: input.BusinessID.String(),
+		Country:    input.Country,
+		Location:   input.Location,
+	}
+	err = services.AddBranch(&branch, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(branch)
 }
 
 func (bc *BranchController) GetBranches(c *fiber.Ctx) error {
-	businessID := c.Query("business_id")
-	if businessID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "business_id is required"})
+	var query models.BranchQuery
+	if err := middleware.BindQuery(c, &query); err != nil {
+		return err
 	}
 
-	branches, err := services.GetBranchesByBusinessID(businessID, bc.DB)
+	branches, err := services.GetBranchesByBusinessID(query.BusinessID, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(branches)
 }
 
 func (bc *BranchController) UpdateBranch(c *fiber.Ctx) error {
-	var branch models.Branch
-	if err := c.BodyParser(&branch); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	input, err := middleware.BoundBody[models.UpdateBranchRequest](c)
+	if err != nil {
+		return err
 	}
 
-	err := services.UpdateBranch(&branch, bc.DB)
+	branch := models.Branch{
+		ID:         input.ID,
+		BusinessID: input.BusinessID.String(),
+		Country:    input.Country,
+		Location:   input.Location,
+	}
+	err = services.UpdateBranch(&branch, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(branch)
 }
 
 func (bc *BranchController) DeleteBranch(c *fiber.Ctx) error {
-	branchID := c.Query("branch_id")
-	businessID := c.Query("business_id")
-	if branchID == "" || businessID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "branch_id and business_id are required"})
+	query, err := middleware.BoundQuery[models.DeleteBranchQuery](c)
+	if err != nil {
+		return err
 	}
 
-	err := services.DeleteBranch(branchID, businessID, bc.DB)
+	err = services.DeleteBranch(query.BranchID, query.BusinessID, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Branch deleted successfully"})
 }
 
 func (bc *BranchController) UpdateBranchesForSubscription(c *fiber.Ctx) error {
-	var req struct {
-		SubscriptionID string   `json:"subscription_id"`
-		BranchChange   int      `json:"branch_change"`
-		BranchNames    []string `json:"branch_names"`
-	}
-
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	req, err := middleware.BoundBody[models.UpdateBranchesForSubscriptionRequest](c)
+	if err != nil {
+		return err
 	}
 
-	err := services.UpdateBranchesForSubscription(req.SubscriptionID, req.BranchChange, req.BranchNames, bc.DB)
+	err = services.UpdateBranchesForSubscription(req.SubscriptionID.String(), req.BranchChange, req.BranchNames, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Branches updated successfully"})
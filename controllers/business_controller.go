@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -16,81 +17,90 @@ type BusinessController struct {
 func (bc *BusinessController) GetAllBusinesses(c *fiber.Ctx) error {
 	businesses, err := services.GetAllBusinesses(bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(businesses)
 }
 
 func (bc *BusinessController) CreateBusiness(c *fiber.Ctx) error {
-	var business models.Business
-	if err := c.BodyParser(&business); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	var input models.CreateBusinessRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	business := models.Business{
+		ID:          utils.GenerateUniqueID(),
+		Name:        input.Name,
+		Description: input.Description,
+		VendorID:    input.VendorID,
+	}
+
+	// Vendors always create businesses for themselves; only admins may pick the vendor.
+	if claims, ok := middleware.GetClaims(c); ok && claims.Role != models.RoleAdmin {
+		business.VendorID = claims.UserID
 	}
 
-	business.ID = utils.GenerateUniqueID()
 	err := services.CreateBusiness(&business, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(business)
 }
 
 func (bc *BusinessController) GetBusinessByID(c *fiber.Ctx) error {
-	businessID := c.Params("business_id")
-	id, err := uuid.Parse(businessID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid business ID"})
+	var params models.BusinessIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	business, err := services.GetBusinessByID(id, bc.DB)
+	business, err := services.GetBusinessByID(uuid.MustParse(params.BusinessID), bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Business not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(business)
 }
 
 func (bc *BusinessController) UpdateBusiness(c *fiber.Ctx) error {
-	var business models.Business
-	if err := c.BodyParser(&business); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	input, err := middleware.BoundBody[models.UpdateBusinessRequest](c)
+	if err != nil {
+		return err
 	}
 
-	err := services.UpdateBusiness(&business, bc.DB)
+	business := models.Business{ID: input.ID, Name: input.Name, Description: input.Description}
+	err = services.UpdateBusiness(&business, bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(business)
 }
 
 func (bc *BusinessController) DeleteBusiness(c *fiber.Ctx) error {
-	businessID := c.Params("business_id")
-	id, err := uuid.Parse(businessID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid business ID"})
+	var params models.BusinessIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	err = services.DeleteBusiness(id, bc.DB)
+	err := services.DeleteBusiness(uuid.MustParse(params.BusinessID), bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Business not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Business deleted successfully"})
 }
 
 func (bc *BusinessController) GetBusinessesByVendorID(c *fiber.Ctx) error {
-	vendorID := c.Params("vendor_id")
-	id, err := uuid.Parse(vendorID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid vendor ID"})
+	var params models.VendorIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	businesses, err := services.GetBusinessesByVendorID(id, bc.DB)
+	businesses, err := services.GetBusinessesByVendorID(uuid.MustParse(params.VendorID), bc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(businesses)
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -14,80 +15,84 @@ type InvoiceController struct {
 }
 
 func (ic *InvoiceController) AddInvoice(c *fiber.Ctx) error {
-	var invoice models.Invoice
-	if err := c.BodyParser(&invoice); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	var input models.AddInvoiceRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
 
-	invoice.ID = utils.GenerateUniqueID()
+	invoice := models.Invoice{
+		ID:        utils.GenerateUniqueID(),
+		PaymentID: input.PaymentID,
+		IssueDate: input.IssueDate,
+		DueDate:   input.DueDate,
+		Status:    input.Status,
+	}
 	err := services.AddInvoice(&invoice, ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(invoice)
 }
 
 func (ic *InvoiceController) GetInvoiceByID(c *fiber.Ctx) error {
-	invoiceID := c.Params("invoice_id")
-	id, err := uuid.Parse(invoiceID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invoice ID"})
+	var params models.InvoiceIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	invoice, err := services.GetInvoiceByID(id, ic.DB)
+	invoice, err := services.GetInvoiceByID(uuid.MustParse(params.InvoiceID), ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invoice not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(invoice)
 }
 
 func (ic *InvoiceController) UpdateInvoice(c *fiber.Ctx) error {
-	var invoice models.Invoice
-	if err := c.BodyParser(&invoice); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	var input models.UpdateInvoiceRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
 
+	invoice := models.Invoice{
+		ID:        input.ID,
+		PaymentID: input.PaymentID,
+		IssueDate: input.IssueDate,
+		DueDate:   input.DueDate,
+		Status:    input.Status,
+	}
 	err := services.UpdateInvoice(&invoice, ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(invoice)
 }
 
 func (ic *InvoiceController) DeleteInvoice(c *fiber.Ctx) error {
-	invoiceID := c.Params("invoice_id")
-	id, err := uuid.Parse(invoiceID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invoice ID"})
+	var params models.InvoiceIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	err = services.DeleteInvoice(id, ic.DB)
+	err := services.DeleteInvoice(uuid.MustParse(params.InvoiceID), ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invoice not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Invoice deleted successfully"})
 }
 
 func (ic *InvoiceController) GenerateInvoiceForPayment(c *fiber.Ctx) error {
-	paymentID := c.Params("payment_id")
-	userID := c.Params("user_id")
-	paymentUUID, err := uuid.Parse(paymentID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payment ID"})
-	}
-
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	var params models.GenerateInvoiceParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	invoice, err := services.GenerateInvoiceForPayment(paymentUUID, userUUID, ic.DB)
+	invoice, err := services.GenerateInvoiceForPayment(uuid.MustParse(params.PaymentID), uuid.MustParse(params.UserID), ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(invoice)
@@ -96,7 +101,7 @@ func (ic *InvoiceController) GenerateInvoiceForPayment(c *fiber.Ctx) error {
 func (ic *InvoiceController) GetAllInvoices(c *fiber.Ctx) error {
 	invoices, err := services.GetAllInvoices(ic.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(invoices)
@@ -1,112 +1,113 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type NotificationController struct {
-	Pool *pgxpool.Pool
+	Pool  *pgxpool.Pool
+	Email utils.EmailSender
 }
 
 func (c *NotificationController) CreateNotification(ctx *fiber.Ctx) error {
-	var notification models.Notification
-	if err := ctx.BodyParser(&notification); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request payload",
-		})
+	var input models.CreateNotificationRequest
+	if err := middleware.BindBody(ctx, &input); err != nil {
+		return err
 	}
 
+	notification := models.Notification{
+		UserID:    input.UserID,
+		InvoiceID: input.InvoiceID,
+		Type:      input.Type,
+		Message:   input.Message,
+	}
 	if err := services.CreateNotification(c.Pool, &notification); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create notification",
-		})
+		return err
 	}
 
 	return ctx.Status(fiber.StatusCreated).JSON(notification)
 }
 
 func (c *NotificationController) GetNotificationByID(ctx *fiber.Ctx) error {
-	idStr := ctx.Params("notification_id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid ID",
-		})
+	var params models.NotificationIDParams
+	if err := middleware.BindParams(ctx, &params); err != nil {
+		return err
 	}
 
-	notification, err := services.GetNotificationByID(c.Pool, id)
+	notification, err := services.GetNotificationByID(c.Pool, uuid.MustParse(params.NotificationID))
 	if err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Notification not found",
-		})
+		return err
 	}
 
 	return ctx.JSON(notification)
 }
 
-func (c *NotificationController) GetNotificationsByUserID(ctx *fiber.Ctx) error {
-	userIdStr := ctx.Params("user_id")
-	userId, err := uuid.Parse(userIdStr)
+// GetOwnNotifications lists the notifications of the signed-in user.
+func (c *NotificationController) GetOwnNotifications(ctx *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(ctx)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+
+	notifications, err := services.GetNotificationsByUserID(c.Pool, claims.UserID)
 	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return err
+	}
+
+	return ctx.JSON(notifications)
+}
+
+func (c *NotificationController) GetNotificationsByUserID(ctx *fiber.Ctx) error {
+	var params models.UserIDParams
+	if err := middleware.BindParams(ctx, &params); err != nil {
+		return err
 	}
 
-	notification, err := services.GetNotificationByUserID(c.Pool, userId)
+	notifications, err := services.GetNotificationsByUserID(c.Pool, uuid.MustParse(params.UserID))
 	if err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Notifications not found",
-		})
+		return err
 	}
 
-	return ctx.JSON(notification)
+	return ctx.JSON(notifications)
 }
 
 func (c *NotificationController) UpdateNotification(ctx *fiber.Ctx) error {
-	var notification models.Notification
-	if err := ctx.BodyParser(&notification); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request payload",
-		})
+	var input models.UpdateNotificationRequest
+	if err := middleware.BindBody(ctx, &input); err != nil {
+		return err
 	}
 
+	notification := models.Notification{ID: input.ID, Type: input.Type, Message: input.Message}
 	if err := services.UpdateNotification(c.Pool, &notification); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update notification",
-		})
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(notification)
 }
 
 func (c *NotificationController) DeleteNotification(ctx *fiber.Ctx) error {
-	idStr := ctx.Params("notification_id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid ID",
-		})
+	var params models.NotificationIDParams
+	if err := middleware.BindParams(ctx, &params); err != nil {
+		return err
 	}
 
-	if err := services.DeleteNotification(c.Pool, id); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete notification",
-		})
+	if err := services.DeleteNotification(c.Pool, uuid.MustParse(params.NotificationID)); err != nil {
+		return err
 	}
 
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
 
 func (c *NotificationController) SendReminderNotifications(ctx *fiber.Ctx) error {
-	if err := services.SendReminderNotification(c.Pool); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to send reminders",
-		})
+	if err := services.SendReminderNotification(c.Pool, c.Email); err != nil {
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -3,73 +3,90 @@ package controllers
 import (
 	"context"
 	"errors"
-	"fmt"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
 )
 
 type PaymentController struct {
-	DB *pgxpool.Pool
+	DB    *pgxpool.Pool
+	Email utils.EmailSender
 }
 
 func (pc *PaymentController) AddPayment(c *fiber.Ctx) error {
-	var payment models.Payment
-	if err := c.BodyParser(&payment); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	var input models.AddPaymentRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	payment := models.Payment{
+		ID:             utils.GenerateUniqueID(),
+		SubscriptionID: input.SubscriptionID,
+		Amount:         input.Amount,
+		Date:           input.Date,
+	}
+	if payment.Date.IsZero() {
+		payment.Date = time.Now()
 	}
 
-	payment.ID = utils.GenerateUniqueID()
 	err := services.AddPayment(&payment, pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(payment)
 }
 
 func (pc *PaymentController) GetPaymentByID(c *fiber.Ctx) error {
-	paymentID := c.Params("payment_id")
-	id, err := uuid.Parse(paymentID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payment ID"})
+	var params models.PaymentIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	payment, err := services.GetPaymentByID(id, pc.DB)
+	payment, err := services.GetPaymentByID(uuid.MustParse(params.PaymentID), pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Payment not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(payment)
 }
 
 func (pc *PaymentController) UpdatePayment(c *fiber.Ctx) error {
-	var payment models.Payment
-	if err := c.BodyParser(&payment); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	var params models.PaymentIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
+	var input models.UpdatePaymentRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	payment := models.Payment{ID: uuid.MustParse(params.PaymentID), Amount: input.Amount, Date: input.Date, Status: input.Status}
 	err := services.UpdatePayment(&payment, pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(payment)
 }
 
 func (pc *PaymentController) DeletePayment(c *fiber.Ctx) error {
-	paymentID := c.Params("payment_id")
-	id, err := uuid.Parse(paymentID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payment ID"})
+	var params models.PaymentIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	err = services.DeletePayment(id, pc.DB)
+	err := services.DeletePayment(uuid.MustParse(params.PaymentID), pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Payment not found"})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Payment deleted successfully"})
@@ -78,93 +95,82 @@ func (pc *PaymentController) DeletePayment(c *fiber.Ctx) error {
 func (pc *PaymentController) GetAllPayments(c *fiber.Ctx) error {
 	payments, err := services.GetAllPayments(pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(payments)
 }
 
 func (pc *PaymentController) GetPaymentsBySubscriptionID(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	id, err := uuid.Parse(subscriptionID)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	payments, err := services.GetPaymentsBySubscriptionID(id, pc.DB)
+	payments, err := services.GetPaymentsBySubscriptionID(uuid.MustParse(params.SubscriptionID), pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(payments)
 }
 
 func (pc *PaymentController) HandleOverduePayment(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
+	}
 
-	err := services.HandleOverduePayment(subscriptionID, pc.DB)
+	err := services.HandleOverduePayment(uuid.MustParse(params.SubscriptionID), pc.DB)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
-			return c.Status(fiber.StatusRequestTimeout).JSON(fiber.Map{"error": "Request timeout"})
+			return fiber.NewError(fiber.StatusRequestTimeout, "Request timeout")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Overdue payment handled successfully"})
 }
 
 func (pc *PaymentController) HandlePartialPayment(c *fiber.Ctx) error {
-	paymentID := c.Params("payment_id")
+	var params models.PaymentIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
+	}
 
-	err := services.HandlePartialPayment(paymentID, pc.DB)
+	err := services.HandlePartialPayment(uuid.MustParse(params.PaymentID), pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Partial payment handled successfully"})
 }
 
 func (pc *PaymentController) ProcessPayment(c *fiber.Ctx) error {
-	type PaymentRequest struct {
-		Amount        float64 `json:"amount" validate:"required,gt=0"`
-		PaymentMethod string  `json:"payment_method" validate:"required"`
-		PhoneNumber   string  `json:"phone_number,omitempty"`
-		Shortcode     string  `json:"shortcode,omitempty"`
-		Description   string  `json:"description,omitempty"`
-	}
-
-	var paymentReq PaymentRequest
-	if err := c.BodyParser(&paymentReq); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
-	}
-
-	if paymentReq.Amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Amount must be greater than zero"})
-	}
-
-	if paymentReq.PaymentMethod == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Payment method is required"})
+	paymentReq, err := middleware.BoundBody[models.ProcessPaymentRequest](c)
+	if err != nil {
+		return err
 	}
 
 	payment := &models.Payment{
-		Amount: paymentReq.Amount,
+		SubscriptionID: paymentReq.SubscriptionID,
+		Amount:         paymentReq.Amount,
 	}
 
 	stripeService := utils.NewMockStripeService()
 	mpesaService := utils.NewMockMpesaService()
 
-	err := services.ProcessPayment(payment, pc.DB, paymentReq.PaymentMethod, stripeService, mpesaService)
+	err = services.ProcessPayment(payment, pc.DB, paymentReq, stripeService, mpesaService)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
-	if err := services.HandlePartialPayment(uuid.Parse(payment.ID), pc.DB); err != nil {
-		fmt.Println("Warning:", err.Error())
+	if err := services.HandlePartialPayment(payment.ID, pc.DB); err != nil {
+		slog.WarnContext(c.UserContext(), "partial payment check failed", slog.String("payment.id", payment.ID.String()), logging.Err(err))
 	}
 
-	emailErr := utils.SendEmail("user@example.com", "Payment Processed", fmt.Sprintf("Your payment of %.2f has been successfully processed.", payment.Amount))
-	if emailErr != nil {
-		fmt.Printf("Failed to send email: %v\n", emailErr)
+	if claims, ok := middleware.GetClaims(c); ok {
+		services.SendPaymentConfirmation(claims.Email, payment, pc.Email)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Payment processed successfully"})
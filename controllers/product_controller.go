@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -18,76 +19,81 @@ func NewProductController(db *pgxpool.Pool) *ProductController {
 }
 
 func (pc *ProductController) AddProduct(c *fiber.Ctx) error {
-	product := new(models.Product)
-	if err := c.BodyParser(product); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	var params models.BusinessIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	// Generate a UUID if none provided
-	if product.ID == uuid.Nil {
-		product.ID = utils.GenerateUniqueID()
+	var input models.ProductRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	product := &models.Product{
+		ID:         utils.GenerateUniqueID(),
+		BusinessID: uuid.MustParse(params.BusinessID),
+		Name:       input.Name,
+		Details:    input.Details,
+		Quantity:   input.Quantity,
+		Price:      input.Price,
 	}
 
 	if err := services.AddProduct(product, pc.DB); err != nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Product added successfully"})
 }
 
 func (pc *ProductController) GetProducts(c *fiber.Ctx) error {
-	businessIDStr := c.Query("business_id")
-	if businessIDStr == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing business_id query parameter"})
-	}
-
-	businessID, err := uuid.Parse(businessIDStr)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid business_id"})
+	var params models.BusinessIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	products, err := services.GetProductsByBusinessID(businessID.String(), pc.DB)
+	products, err := services.GetProductsByBusinessID(params.BusinessID, pc.DB)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(products)
 }
 
 func (pc *ProductController) UpdateProduct(c *fiber.Ctx) error {
-	product := new(models.Product)
-	if err := c.BodyParser(product); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request payload"})
+	var params models.ProductParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	if product.ID == uuid.Nil || product.BusinessID == uuid.Nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Product ID and Business ID are required"})
+	var input models.ProductRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	product := &models.Product{
+		ID:         uuid.MustParse(params.ProductID),
+		BusinessID: uuid.MustParse(params.BusinessID),
+		Name:       input.Name,
+		Details:    input.Details,
+		Quantity:   input.Quantity,
+		Price:      input.Price,
 	}
 
 	if err := services.UpdateProduct(product, pc.DB); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(fiber.Map{"message": "Product updated successfully"})
 }
 
 func (pc *ProductController) DeleteProduct(c *fiber.Ctx) error {
-	productIDStr := c.Query("product_id")
-	businessIDStr := c.Query("business_id")
-
-	if productIDStr == "" || businessIDStr == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing product_id or business_id query parameters"})
-	}
-
-	productID, err1 := uuid.Parse(productIDStr)
-	businessID, err2 := uuid.Parse(businessIDStr)
-
-	if err1 != nil || err2 != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product_id or business_id"})
+	var params models.ProductParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	if err := services.DeleteProduct(productID.String(), businessID.String(), pc.DB); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	if err := services.DeleteProduct(params.ProductID, params.BusinessID, pc.DB); err != nil {
+		return err
 	}
 
 	return c.JSON(fiber.Map{"message": "Product deleted successfully"})
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"github.com/Bradkibs/MONOS-challenge/middleware"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/Bradkibs/MONOS-challenge/utils"
@@ -20,113 +21,135 @@ func NewSubscriptionController(db *pgxpool.Pool) *SubscriptionController {
 }
 
 func (sc *SubscriptionController) CreateSubscription(c *fiber.Ctx) error {
-	var req models.Subscription
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	input, err := middleware.BoundBody[models.CreateSubscriptionRequest](c)
+	if err != nil {
+		return err
 	}
 
 	// Set default values
-	req.ID = utils.GenerateUniqueID()
-	req.Status = "active"
-	req.StartDate = time.Now()
+	req := models.Subscription{
+		ID:         utils.GenerateUniqueID(),
+		BusinessID: input.BusinessID,
+		Tier:       input.Tier,
+		StartDate:  time.Now(),
+		EndDate:    input.EndDate,
+		Status:     "active",
+	}
 
 	if req.EndDate == nil {
 		endDate := req.StartDate.AddDate(0, 1, 0)
 		req.EndDate = &endDate
 	}
 
-	err := services.CreateSubscription(&req, sc.DB)
+	err = services.CreateSubscription(&req, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.Status(http.StatusCreated).JSON(req)
 }
 
 func (sc *SubscriptionController) GetSubscription(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	_, err := uuid.Parse(subscriptionID)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	subscription, err := services.GetSubscription(subscriptionID, sc.DB)
+	subscription, err := services.GetSubscription(params.SubscriptionID, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(subscription)
 }
 
 func (sc *SubscriptionController) UpdateSubscription(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	_, err := uuid.Parse(subscriptionID)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	var req models.Subscription
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	var input models.UpdateSubscriptionRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
 	}
 
-	req.ID = uuid.MustParse(subscriptionID)
-	err = services.UpdateSubscription(&req, sc.DB)
+	req := models.Subscription{
+		ID:        uuid.MustParse(params.SubscriptionID),
+		Tier:      input.Tier,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+		Status:    input.Status,
+	}
+	err := services.UpdateSubscription(&req, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(req)
 }
 
 func (sc *SubscriptionController) CancelSubscription(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	_, err := uuid.Parse(subscriptionID)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	err = services.CancelSubscription(subscriptionID, sc.DB)
+	err := services.CancelSubscription(params.SubscriptionID, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(fiber.Map{"message": "Subscription canceled successfully"})
 }
 
 func (sc *SubscriptionController) DowngradeSubscription(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	_, err := uuid.Parse(subscriptionID)
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
+	}
+
+	var request models.ChangeTierRequest
+	if err := middleware.BindBody(c, &request); err != nil {
+		return err
+	}
+
+	err := services.DowngradeSubscription(params.SubscriptionID, request.NewTier, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+		return err
 	}
 
-	var request struct {
-		NewTier string `json:"new_tier"`
+	return c.JSON(fiber.Map{"message": "Subscription downgraded successfully"})
+}
+
+func (sc *SubscriptionController) UpgradeSubscription(c *fiber.Ctx) error {
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	if err := c.BodyParser(&request); err != nil || request.NewTier == "" {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "New tier is required"})
+	var request models.ChangeTierRequest
+	if err := middleware.BindBody(c, &request); err != nil {
+		return err
 	}
 
-	err = services.DowngradeSubscription(subscriptionID, request.NewTier, sc.DB)
+	err := services.UpgradeSubscription(params.SubscriptionID, request.NewTier, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
-	return c.JSON(fiber.Map{"message": "Subscription downgraded successfully"})
+	return c.JSON(fiber.Map{"message": "Subscription upgraded successfully"})
 }
 
 func (sc *SubscriptionController) DeleteSubscription(c *fiber.Ctx) error {
-	subscriptionID := c.Params("subscription_id")
-	_, err := uuid.Parse(subscriptionID)
-	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid subscription ID"})
+	var params models.SubscriptionIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
 	}
 
-	err = services.DeleteSubscription(subscriptionID, sc.DB)
+	err := services.DeleteSubscription(params.SubscriptionID, sc.DB)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return c.JSON(fiber.Map{"message": "Subscription deleted successfully"})
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserController struct {
+	DB    *pgxpool.Pool
+	SMS   utils.SMSSender
+	Email utils.EmailSender
+}
+
+func (uc *UserController) GetProfile(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+
+	profile, err := services.GetProfile(claims.UserID, uc.DB)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(profile)
+}
+
+func (uc *UserController) UpdateProfile(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.UpdateProfileRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	profile, err := services.UpdateProfile(claims.UserID, input, uc.SMS, uc.Email, uc.DB)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(profile)
+}
+
+// Deactivate closes the account and signs the user out everywhere.
+func (uc *UserController) Deactivate(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.CloseAccountRequest
+	if len(c.Body()) > 0 {
+		if err := middleware.BindBody(c, &input); err != nil {
+			return err
+		}
+	}
+
+	if err := services.DeactivateAccount(claims, input.Password, uc.DB); err != nil {
+		return err
+	}
+
+	middleware.ClearSessionCookie(c)
+	middleware.ClearRefreshCookie(c)
+	return c.JSON(fiber.Map{"message": "Account deactivated successfully"})
+}
+
+// Delete closes the account and erases the user's personal data.
+func (uc *UserController) Delete(c *fiber.Ctx) error {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("authentication required")
+	}
+	var input models.CloseAccountRequest
+	if len(c.Body()) > 0 {
+		if err := middleware.BindBody(c, &input); err != nil {
+			return err
+		}
+	}
+
+	if err := services.DeleteAccount(claims, input.Password, uc.DB); err != nil {
+		return err
+	}
+
+	middleware.ClearSessionCookie(c)
+	middleware.ClearRefreshCookie(c)
+	return c.JSON(fiber.Map{"message": "Account deleted successfully"})
+}
+
+// Erase erases another user's account on an administrator's request, even
+// one that is already deactivated.
+func (uc *UserController) Erase(c *fiber.Ctx) error {
+	var params models.UserIDParams
+	if err := middleware.BindParams(c, &params); err != nil {
+		return err
+	}
+
+	if err := services.EraseAccount(uuid.MustParse(params.UserID), uc.DB); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"message": "Account erased successfully"})
+}
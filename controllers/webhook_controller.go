@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"log/slog"
+
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebhookController receives payment gateway callbacks. The routes carry no
+// user authentication; they are restricted to the gateways' networks.
+type WebhookController struct{}
+
+// MpesaCallback records the result of an STK push and acknowledges it in the
+// format Daraja expects; any other answer makes it retry the notification.
+// Payments are not reconciled from callbacks yet.
+func (wc *WebhookController) MpesaCallback(c *fiber.Ctx) error {
+	var input models.MpesaCallbackRequest
+	if err := middleware.BindBody(c, &input); err != nil {
+		return err
+	}
+
+	callback := input.Body.STKCallback
+	slog.InfoContext(c.UserContext(), "m-pesa callback received",
+		slog.String("transaction.id", callback.CheckoutRequestID),
+		slog.Int("mpesa.result_code", callback.ResultCode),
+		slog.String("mpesa.result_desc", callback.ResultDesc))
+
+	return c.JSON(fiber.Map{"ResultCode": 0, "ResultDesc": "Accepted"})
+}
@@ -0,0 +1,177 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxBufferedBatches bounds memory while Elasticsearch is unreachable; the
+// oldest records are dropped first.
+const maxBufferedBatches = 10
+
+// ElasticShipper is an io.Writer that buffers JSON log lines and sends them
+// to an Elasticsearch-compatible _bulk endpoint in batches.
+type ElasticShipper struct {
+	client    *http.Client
+	bulkURL   string
+	index     string
+	apiKey    string
+	batchSize int
+
+	mu      sync.Mutex
+	pending [][]byte
+	dropped int
+
+	flush     chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewElasticShipper(url, index, apiKey string, batchSize int, interval time.Duration) *ElasticShipper {
+	s := &ElasticShipper{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		bulkURL:   url + "/_bulk",
+		index:     index,
+		apiKey:    apiKey,
+		batchSize: batchSize,
+		flush:     make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// Write queues one log record. slog handlers call Write once per record, so p
+// is a complete newline-terminated JSON document.
+func (s *ElasticShipper) Write(p []byte) (int, error) {
+	line := bytes.Clone(p)
+
+	s.mu.Lock()
+	s.pending = append(s.pending, line)
+	if overflow := len(s.pending) - s.batchSize*maxBufferedBatches; overflow > 0 {
+		s.pending = s.pending[overflow:]
+		s.dropped += overflow
+	}
+	full := len(s.pending) >= s.batchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (s *ElasticShipper) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flush:
+		case <-s.stop:
+			return
+		}
+		if err := s.Flush(context.Background()); err != nil {
+			reportFailure(err)
+		}
+	}
+}
+
+// Flush sends every queued record. Records from a failed request are put
+// back at the front of the queue for the next attempt.
+func (s *ElasticShipper) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		reportFailure(fmt.Errorf("dropped %d log records while the buffer was full", dropped))
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := s.send(ctx, batch); err != nil {
+		s.mu.Lock()
+		s.pending = append(batch, s.pending...)
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *ElasticShipper) send(ctx context.Context, batch [][]byte) error {
+	action, err := json.Marshal(map[string]any{"create": map[string]string{"_index": s.index}})
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	for _, line := range batch {
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(line)
+		if !bytes.HasSuffix(line, []byte("\n")) {
+			body.WriteByte('\n')
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.bulkURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("bulk request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("bulk request failed with status %d", resp.StatusCode)
+	}
+
+	// A 200 can still carry per-document failures, e.g. mapping conflicts.
+	// Those records are not retried since resending would fail the same way.
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.Errors {
+		reportFailure(fmt.Errorf("bulk request rejected some of %d log records", len(batch)))
+	}
+	return nil
+}
+
+// Close stops the background flusher and sends whatever is still queued.
+func (s *ElasticShipper) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return s.Flush(ctx)
+}
+
+// reportFailure writes shipping problems straight to stderr; logging them
+// through slog would queue yet more records for the failing endpoint.
+func reportFailure(err error) {
+	fmt.Fprintf(os.Stderr, "log shipping: %v\n", err)
+}
@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkStub is a local stand-in for the Elasticsearch _bulk endpoint.
+type bulkStub struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	// failures is the number of requests to answer with 503 before
+	// accepting.
+	failures int
+}
+
+func (b *bulkStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	b.requests = append(b.requests, r)
+	b.bodies = append(b.bodies, body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"errors":false,"items":[]}`))
+}
+
+// ndjson splits a bulk body into its action and document lines.
+func ndjson(t *testing.T, body []byte) (actions, docs []map[string]any) {
+	t.Helper()
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		t.Fatalf("bulk body does not end with a newline: %q", body)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for i := 0; scanner.Scan(); i++ {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %d is not JSON: %q", i+1, scanner.Text())
+		}
+		if i%2 == 0 {
+			actions = append(actions, line)
+		} else {
+			docs = append(docs, line)
+		}
+	}
+	if len(actions) != len(docs) {
+		t.Fatalf("got %d actions for %d documents", len(actions), len(docs))
+	}
+	return actions, docs
+}
+
+func TestElasticShipperSendsECSRecords(t *testing.T) {
+	stub := &bulkStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	shipper := NewElasticShipper(server.URL, "logs-test", "secret-key", 100, time.Hour)
+	logger := slog.New(NewHandler(shipper, Options{Level: slog.LevelInfo, ServiceName: "monos-test"}))
+	logger.Info("payment processed", slog.String("payment.id", "p-1"))
+	logger.Error("payment failed", Err(errors.New("card declined")))
+	logger.Debug("below the level")
+
+	if err := shipper.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if len(stub.requests) != 1 {
+		t.Fatalf("got %d bulk requests, want 1", len(stub.requests))
+	}
+	req := stub.requests[0]
+	if req.Method != http.MethodPost || req.URL.Path != "/_bulk" {
+		t.Errorf("request = %s %s, want POST /_bulk", req.Method, req.URL.Path)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want application/x-ndjson", got)
+	}
+	if got := req.Header.Get("Authorization"); got != "ApiKey secret-key" {
+		t.Errorf("Authorization = %q, want ApiKey secret-key", got)
+	}
+
+	actions, docs := ndjson(t, stub.bodies[0])
+	if len(docs) != 2 {
+		t.Fatalf("got %d documents, want 2", len(docs))
+	}
+	for i, action := range actions {
+		create, ok := action["create"].(map[string]any)
+		if !ok || create["_index"] != "logs-test" {
+			t.Errorf("action %d = %v, want create into logs-test", i+1, action)
+		}
+	}
+
+	for i, doc := range docs {
+		for _, field := range []string{"@timestamp", "log.level", "message", "ecs.version", "service.name"} {
+			if _, ok := doc[field]; !ok {
+				t.Errorf("document %d has no %s field: %v", i+1, field, doc)
+			}
+		}
+		for _, field := range []string{slog.TimeKey, slog.LevelKey, slog.MessageKey} {
+			if _, ok := doc[field]; ok {
+				t.Errorf("document %d still has slog field %q", i+1, field)
+			}
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(doc["@timestamp"])); err != nil {
+			t.Errorf("document %d @timestamp = %v, want RFC 3339", i+1, doc["@timestamp"])
+		}
+		if doc["service.name"] != "monos-test" || doc["ecs.version"] != ecsVersion {
+			t.Errorf("document %d service.name, ecs.version = %v, %v", i+1, doc["service.name"], doc["ecs.version"])
+		}
+	}
+
+	if docs[0]["log.level"] != "info" || docs[0]["message"] != "payment processed" || docs[0]["payment.id"] != "p-1" {
+		t.Errorf("first document = %v", docs[0])
+	}
+	if docs[1]["log.level"] != "error" || docs[1]["error.message"] != "card declined" {
+		t.Errorf("second document = %v", docs[1])
+	}
+}
+
+// newTestShipper returns a shipper without the background flusher so the
+// test decides when batches are sent.
+func newTestShipper(url string, batchSize int) *ElasticShipper {
+	return &ElasticShipper{
+		client:    &http.Client{Timeout: 5 * time.Second},
+		bulkURL:   url + "/_bulk",
+		index:     "logs-test",
+		batchSize: batchSize,
+		flush:     make(chan struct{}, 1),
+	}
+}
+
+func TestElasticShipperDropsOldestWhenFull(t *testing.T) {
+	stub := &bulkStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	shipper := newTestShipper(server.URL, 2)
+	capacity := 2 * maxBufferedBatches
+	for i := 1; i <= capacity+5; i++ {
+		fmt.Fprintf(shipper, "{\"message\":\"record %d\"}\n", i)
+	}
+
+	if err := shipper.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	_, docs := ndjson(t, stub.bodies[0])
+	if len(docs) != capacity {
+		t.Fatalf("shipped %d records, want the buffer capacity %d", len(docs), capacity)
+	}
+	if first := docs[0]["message"]; first != "record 6" {
+		t.Errorf("first shipped record = %v, want record 6 after dropping the oldest five", first)
+	}
+	if last := docs[len(docs)-1]["message"]; last != fmt.Sprintf("record %d", capacity+5) {
+		t.Errorf("last shipped record = %v", last)
+	}
+	if shipper.dropped != 0 {
+		t.Errorf("dropped counter = %d after Flush, want it reset", shipper.dropped)
+	}
+}
+
+func TestElasticShipperRetriesFailedBatch(t *testing.T) {
+	stub := &bulkStub{failures: 1}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	shipper := newTestShipper(server.URL, 10)
+	fmt.Fprintln(shipper, `{"message":"first"}`)
+
+	if err := shipper.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded against a failing endpoint")
+	}
+
+	fmt.Fprintln(shipper, `{"message":"second"}`)
+	if err := shipper.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	_, docs := ndjson(t, stub.bodies[0])
+	if len(docs) != 2 || docs[0]["message"] != "first" || docs[1]["message"] != "second" {
+		t.Fatalf("shipped %v, want the failed record first, then the new one", docs)
+	}
+}
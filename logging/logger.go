@@ -0,0 +1,101 @@
+// Package logging configures the process-wide slog logger to emit JSON
+// records using Elastic Common Schema (ECS) field names, optionally shipping
+// them to Elasticsearch.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/config"
+)
+
+const ecsVersion = "8.11.0"
+
+// Options controls the log level, the service name stamped on every record
+// and where records are shipped besides stdout.
+type Options struct {
+	Level         slog.Level
+	ServiceName   string
+	ElasticURL    string
+	ElasticIndex  string
+	ElasticAPIKey string
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// OptionsFromEnv reads LOG_LEVEL and the ELASTICSEARCH_* variables. Shipping
+// is disabled when ELASTICSEARCH_URL is empty.
+func OptionsFromEnv() Options {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Getenv("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	return Options{
+		Level:         level,
+		ServiceName:   config.Getenv("SERVICE_NAME", "monos-api"),
+		ElasticURL:    strings.TrimRight(config.Getenv("ELASTICSEARCH_URL", ""), "/"),
+		ElasticIndex:  config.Getenv("ELASTICSEARCH_INDEX", "logs-monos-default"),
+		ElasticAPIKey: config.Getenv("ELASTICSEARCH_API_KEY", ""),
+		BatchSize:     500,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// Setup installs the ECS JSON logger as the slog default. When an
+// Elasticsearch URL is configured it also returns the shipper, which the
+// caller must Close on shutdown so buffered records are flushed.
+func Setup(opts Options) *ElasticShipper {
+	var out io.Writer = os.Stdout
+	var shipper *ElasticShipper
+	if opts.ElasticURL != "" {
+		shipper = NewElasticShipper(opts.ElasticURL, opts.ElasticIndex, opts.ElasticAPIKey, opts.BatchSize, opts.FlushInterval)
+		out = io.MultiWriter(os.Stdout, shipper)
+	}
+
+	slog.SetDefault(slog.New(NewHandler(out, opts)))
+	return shipper
+}
+
+// NewHandler returns a JSON handler writing ECS-shaped records to w.
+func NewHandler(w io.Writer, opts Options) slog.Handler {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: ecsAttr,
+	})
+	return handler.WithAttrs([]slog.Attr{
+		slog.String("ecs.version", ecsVersion),
+		slog.String("service.name", opts.ServiceName),
+	})
+}
+
+// ecsAttr renames slog's built-in keys to their ECS equivalents.
+func ecsAttr(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return attr
+	}
+
+	switch attr.Key {
+	case slog.TimeKey:
+		attr.Key = "@timestamp"
+		attr.Value = slog.StringValue(attr.Value.Time().UTC().Format(time.RFC3339Nano))
+	case slog.LevelKey:
+		attr.Key = "log.level"
+		attr.Value = slog.StringValue(strings.ToLower(attr.Value.String()))
+	case slog.MessageKey:
+		attr.Key = "message"
+	}
+	return attr
+}
+
+// Err formats err under the ECS error.message field.
+func Err(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+	return slog.String("error.message", err.Error())
+}
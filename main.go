@@ -1 +1,212 @@
 package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/config"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/migrations"
+	"github.com/Bradkibs/MONOS-challenge/routes"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+)
+
+const (
+	shutdownTimeout    = 15 * time.Second
+	directoryCacheTTL  = 5 * time.Minute
+	directoryCacheSize = 1000
+	// minJWTSecretLength is the HMAC key size for HS256 tokens in bytes.
+	minJWTSecretLength = 32
+)
+
+func main() {
+	envErr := config.LoadEnv()
+	logShipper := logging.Setup(logging.OptionsFromEnv())
+	flushLogs := func() {
+		if logShipper == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := logShipper.Close(ctx); err != nil {
+			slog.Error("failed to flush logs", logging.Err(err))
+		}
+	}
+	fatal := func(message string, err error) {
+		slog.Error(message, logging.Err(err))
+		flushLogs()
+		os.Exit(1)
+	}
+
+	if envErr != nil {
+		fatal("failed to load environment", envErr)
+	}
+
+	pool, err := config.Connect()
+	if err != nil {
+		fatal("failed to connect to the database", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(context.Background(), pool, os.Args[2:])
+		pool.Close()
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		flushLogs()
+		return
+	}
+
+	if config.Getenv("DB_AUTO_MIGRATE", "true") == "true" {
+		if _, err := migrations.Up(context.Background(), pool); err != nil {
+			fatal("failed to migrate the database", err)
+		}
+	}
+
+	redisClient, err := config.ConnectRedis()
+	if err != nil {
+		fatal("failed to connect to redis", err)
+	}
+
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	var cacheStore middleware.CacheStore = middleware.NewLRUCacheStore(directoryCacheSize)
+	if redisClient != nil {
+		rateLimitStore = middleware.NewRedisRateLimitStore(redisClient)
+		cacheStore = middleware.NewRedisCacheStore(redisClient)
+	}
+
+	corsConfig, err := middleware.CORSConfigFromEnv()
+	if err != nil {
+		fatal("invalid CORS configuration", err)
+	}
+
+	trustedProxies, err := middleware.ParseCIDRList(config.Getenv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		fatal("invalid TRUSTED_PROXIES", err)
+	}
+	adminNetworks, err := middleware.ParseCIDRList(config.Getenv("ADMIN_ALLOWED_NETWORKS", "127.0.0.1/32,::1/128"))
+	if err != nil {
+		fatal("invalid ADMIN_ALLOWED_NETWORKS", err)
+	}
+	webhookNetworks, err := middleware.ParseCIDRList(config.Getenv("WEBHOOK_ALLOWED_NETWORKS", ""))
+	if err != nil {
+		fatal("invalid WEBHOOK_ALLOWED_NETWORKS", err)
+	}
+
+	// JWT_SECRET signs access tokens and keys the verification code and MFA
+	// secret digests, so the server must not start without a strong one.
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if len(jwtSecret) < minJWTSecretLength {
+		fatal("invalid JWT configuration", fmt.Errorf("JWT_SECRET must be at least %d bytes", minJWTSecretLength))
+	}
+
+	csrfSecret := config.Getenv("CSRF_SECRET", jwtSecret)
+
+	oidcProviders, err := services.OIDCProvidersFromEnv()
+	if err != nil {
+		fatal("invalid OIDC configuration", err)
+	}
+
+	smsSender, smsProvider, err := utils.SMSSenderFromEnv()
+	if err != nil {
+		fatal("invalid SMS configuration", err)
+	}
+	if smsProvider == utils.SMSProviderMock {
+		slog.Warn("SMS_PROVIDER is not set, text messages will not be delivered")
+	}
+	emailSender, emailProvider, err := utils.EmailSenderFromEnv()
+	if err != nil {
+		fatal("invalid email configuration", err)
+	}
+	if emailProvider == utils.EmailProviderMock {
+		slog.Warn("EMAIL_PROVIDER is not set, email will not be delivered")
+	}
+
+	directoryCache := middleware.NewResponseCache(cacheStore, directoryCacheTTL)
+	services.OnResourceChange(func(kind services.ResourceKind) {
+		if kind == services.ResourceBusiness || kind == services.ResourceProduct {
+			directoryCache.Invalidate("directory")
+		}
+	})
+
+	app := fiber.New(fiber.Config{
+		AppName:      "MONOS business directory",
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  60 * time.Second,
+		ErrorHandler: middleware.ErrorHandler,
+	})
+
+	app.Use(requestid.New())
+	app.Use(middleware.TrustProxies(trustedProxies))
+	app.Use(middleware.RequestLogger(slog.Default()))
+	app.Use(recover.New())
+	app.Use(middleware.Security(middleware.DefaultSecurityPolicy,
+		middleware.RouteSecurityPolicy{Method: fiber.MethodPost, Pattern: "/webhooks/*", Policy: middleware.WebhookSecurityPolicy},
+	))
+	app.Use(middleware.CORS(corsConfig))
+	app.Use(middleware.CSRFProtect([]byte(csrfSecret)))
+	app.Use(middleware.RestrictAdminNetworks(adminNetworks))
+	// Payment gateway callbacks are unauthenticated; only the gateways'
+	// networks may reach them.
+	app.Use("/webhooks", middleware.AllowIPs(webhookNetworks))
+	loginLimit := middleware.RateLimit(rateLimitStore, middleware.LoginRateLimit)
+	app.Use("/auth/login", loginLimit)
+	app.Use("/auth/mfa/verify", loginLimit)
+	passwordResetLimit := middleware.RateLimit(rateLimitStore, middleware.PasswordResetRateLimit)
+	app.Use("/auth/password/forgot", passwordResetLimit)
+	app.Use("/auth/password/reset", passwordResetLimit)
+	app.Use("/payments/process", middleware.RateLimit(rateLimitStore, middleware.PaymentRateLimit))
+	app.Use(middleware.RateLimit(rateLimitStore, middleware.ReadRateLimit))
+	app.Use(middleware.Compress(middleware.DefaultCompressionConfig))
+	app.Use("/businesses", directoryCache.Handler("directory"))
+
+	routes.SetupAuthRoutes(app, pool, oidcProviders, smsSender, emailSender)
+	routes.SetupUserRoutes(app, pool, smsSender, emailSender)
+	routes.SetupBusinessRoutes(app, pool)
+	routes.SetupBranchRoutes(app, pool)
+	routes.SetupProductRoutes(app, pool)
+	routes.SetupSubscriptionRoutes(app, pool)
+	routes.SetupPaymentRoutes(app, pool, emailSender)
+	routes.SetupInvoiceRoutes(app, pool)
+	routes.SetupNotificationRoutes(app, pool, emailSender)
+	routes.SetupWebhookRoutes(app)
+
+	go func() {
+		addr := ":" + config.Getenv("PORT", "3000")
+		if err := app.Listen(addr); err != nil {
+			fatal("server stopped unexpectedly", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	slog.Info("shutting down, draining in-flight requests")
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		slog.Error("error during server shutdown", logging.Err(err))
+	}
+	backgroundCtx, cancelBackground := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := services.WaitForBackgroundTasks(backgroundCtx); err != nil {
+		slog.Error("messages still pending at shutdown", logging.Err(err))
+	}
+	cancelBackground()
+
+	pool.Close()
+	if redisClient != nil {
+		redisClient.Close()
+	}
+	slog.Info("server stopped")
+	flushLogs()
+}
@@ -1 +1,197 @@
 package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ClaimsKey is the fiber.Ctx locals key under which Authenticate stores the
+// validated token claims.
+const ClaimsKey = "claims"
+
+// SessionCookie carries the access token for browser sessions such as the
+// admin dashboard. Requests authenticated by it are subject to CSRFProtect.
+const SessionCookie = "session"
+
+// RefreshCookie carries the refresh token for browser sessions. It is only
+// sent to the /auth endpoints.
+const RefreshCookie = "refresh_token"
+
+// OIDCStateCookie binds a pending identity provider login to the browser
+// that started it, so a callback URL cannot be replayed in another browser.
+const OIDCStateCookie = "oidc_state"
+
+// Authenticate rejects requests that do not carry a valid token, either as
+// "Bearer" in the Authorization header or in the session cookie. On success
+// the parsed *models.Claims are stored in the request locals under ClaimsKey
+// for downstream handlers. Revoked tokens are rejected, as are tokens of
+// administrators whose session was not established with a second factor.
+func Authenticate(db *pgxpool.Pool) fiber.Handler {
+	return authenticate(db, true)
+}
+
+// AuthenticatePendingMFA is Authenticate without the two-factor requirement
+// for administrators. It is only for the routes an administrator needs to
+// enroll in two-factor authentication or sign out.
+func AuthenticatePendingMFA(db *pgxpool.Pool) fiber.Handler {
+	return authenticate(db, false)
+}
+
+func authenticate(db *pgxpool.Pool, requireAdminMFA bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString, ok := BearerToken(c)
+		if !ok {
+			tokenString, ok = SessionToken(c)
+		}
+		if !ok {
+			return apperrors.Unauthorized("missing bearer token")
+		}
+
+		claims, err := services.ParseJWT(tokenString, db)
+		if err != nil {
+			return err
+		}
+
+		if err := claims.Valid(); err != nil {
+			return apperrors.Unauthorized(err.Error())
+		}
+
+		if requireAdminMFA && claims.Role == models.RoleAdmin && !claims.MFA {
+			return apperrors.Forbidden("administrators must sign in with two-factor authentication, enroll at /auth/mfa/enroll")
+		}
+
+		c.Locals(ClaimsKey, claims)
+		return c.Next()
+	}
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header. The scheme is matched case-insensitively.
+func BearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, found := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// requestClaims returns the claims of the request's bearer or session token
+// without rejecting the request, for app-wide middleware that runs before
+// Authenticate. The revocation list is not consulted.
+func requestClaims(c *fiber.Ctx) (*models.Claims, bool) {
+	if claims, ok := GetClaims(c); ok {
+		return claims, true
+	}
+
+	token, ok := BearerToken(c)
+	if !ok {
+		token, ok = SessionToken(c)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	claims, err := services.DecodeJWT(token)
+	if err != nil || claims.Valid() != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// SessionToken returns the access token held in the session cookie.
+func SessionToken(c *fiber.Ctx) (string, bool) {
+	token := c.Cookies(SessionCookie)
+	return token, token != ""
+}
+
+// SetSessionCookie stores token in an HttpOnly session cookie that expires
+// with the token.
+func SetSessionCookie(c *fiber.Ctx, token string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookie ends a browser session.
+func ClearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// SetRefreshCookie stores the refresh token of a browser session. SameSite
+// Strict keeps cross-site requests from presenting it.
+func SetRefreshCookie(c *fiber.Ctx, token string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     RefreshCookie,
+		Value:    token,
+		Path:     "/auth",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// ClearRefreshCookie removes the refresh token of a browser session.
+func ClearRefreshCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     RefreshCookie,
+		Path:     "/auth",
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// SetOIDCStateCookie remembers the state of a login started by this browser.
+// SameSite Lax lets the cookie through on the provider's redirect back.
+func SetOIDCStateCookie(c *fiber.Ctx, state string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// ClearOIDCStateCookie removes the state cookie once the login completes.
+func ClearOIDCStateCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     OIDCStateCookie,
+		Path:     "/auth/oidc",
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// GetClaims returns the claims stored by Authenticate, if any.
+func GetClaims(c *fiber.Ctx) (*models.Claims, bool) {
+	claims, ok := c.Locals(ClaimsKey).(*models.Claims)
+	return claims, ok
+}
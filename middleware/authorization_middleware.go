@@ -1 +1,49 @@
 package middleware
+
+import (
+	"slices"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RequireRole only lets requests through when the authenticated user holds
+// one of the given roles. It must run after Authenticate.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := GetClaims(c)
+		if !ok {
+			return apperrors.Unauthorized("authentication required")
+		}
+
+		if !slices.Contains(roles, claims.Role) {
+			return apperrors.Forbidden("insufficient role")
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireVerified only lets requests through from accounts that have
+// verified their email address or phone number. It must run after
+// Authenticate.
+func RequireVerified(db *pgxpool.Pool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := GetClaims(c)
+		if !ok {
+			return apperrors.Unauthorized("authentication required")
+		}
+
+		verified, err := services.IsUserVerified(claims.UserID, db)
+		if err != nil {
+			return err
+		}
+		if !verified {
+			return apperrors.Forbidden("verify your email address or phone number first")
+		}
+
+		return c.Next()
+	}
+}
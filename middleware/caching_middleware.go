@@ -1 +1,245 @@
 package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// CachedResponse is a successful response body kept for replay.
+type CachedResponse struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+	Body        []byte `json:"body"`
+}
+
+// CacheStore keeps cached responses grouped by tag so that every entry
+// derived from the same data can be dropped at once.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, bool, error)
+	Set(ctx context.Context, tag, key string, response *CachedResponse, ttl time.Duration) error
+	Invalidate(ctx context.Context, tag string) error
+}
+
+// ResponseCache serves repeated GET requests from a CacheStore and answers
+// conditional requests with 304 Not Modified.
+type ResponseCache struct {
+	store CacheStore
+	ttl   time.Duration
+}
+
+func NewResponseCache(store CacheStore, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{store: store, ttl: ttl}
+}
+
+// Handler caches successful GET responses under tag, keyed by the request URL.
+func (rc *ResponseCache) Handler(tag string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet {
+			return c.Next()
+		}
+
+		key := "cache:" + tag + ":" + c.OriginalURL()
+		cached, found, err := rc.store.Get(c.UserContext(), key)
+		if err != nil {
+			slog.Warn("cache store error", slog.String("cache.key", key), logging.Err(err))
+		}
+		if found {
+			c.Set("X-Cache", "HIT")
+			return writeCachedResponse(c, cached)
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+
+		body := c.Response().Body()
+		sum := sha256.Sum256(body)
+		response := &CachedResponse{
+			ContentType: string(c.Response().Header.ContentType()),
+			ETag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+			Body:        append([]byte(nil), body...),
+		}
+		if err := rc.store.Set(c.UserContext(), tag, key, response, rc.ttl); err != nil {
+			slog.Warn("cache store error", slog.String("cache.key", key), logging.Err(err))
+		}
+
+		c.Set("X-Cache", "MISS")
+		return writeCachedResponse(c, response)
+	}
+}
+
+// Invalidate drops every response cached under tag.
+func (rc *ResponseCache) Invalidate(tag string) {
+	if err := rc.store.Invalidate(context.Background(), tag); err != nil {
+		slog.Warn("cache invalidation failed", slog.String("cache.tag", tag), logging.Err(err))
+	}
+}
+
+func writeCachedResponse(c *fiber.Ctx, response *CachedResponse) error {
+	c.Set(fiber.HeaderETag, response.ETag)
+	c.Set(fiber.HeaderCacheControl, "public, no-cache")
+
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), response.ETag) {
+		c.Response().ResetBody()
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, response.ContentType)
+	return c.Status(fiber.StatusOK).Send(response.Body)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// LRUCacheStore is an in-process CacheStore that evicts the least recently
+// used entry once it holds capacity responses.
+type LRUCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type lruEntry struct {
+	tag       string
+	key       string
+	response  *CachedResponse
+	expiresAt time.Time
+}
+
+func NewLRUCacheStore(capacity int) *LRUCacheStore {
+	return &LRUCacheStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.remove(element)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(element)
+	return entry.response, true, nil
+}
+
+func (s *LRUCacheStore) Set(_ context.Context, tag, key string, response *CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &lruEntry{tag: tag, key: key, response: response, expiresAt: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *LRUCacheStore) Invalidate(_ context.Context, tag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for element := s.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*lruEntry).tag == tag {
+			s.remove(element)
+		}
+		element = next
+	}
+	return nil
+}
+
+func (s *LRUCacheStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*lruEntry).key)
+}
+
+// RedisCacheStore shares cached responses between API instances. Each tag is
+// tracked as a Redis set of the keys cached under it.
+type RedisCacheStore struct {
+	client *redis.Client
+}
+
+func NewRedisCacheStore(client *redis.Client) *RedisCacheStore {
+	return &RedisCacheStore{client: client}
+}
+
+func (s *RedisCacheStore) Get(ctx context.Context, key string) (*CachedResponse, bool, error) {
+	data, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var response CachedResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, false, err
+	}
+	return &response, true, nil
+}
+
+func (s *RedisCacheStore) Set(ctx context.Context, tag, key string, response *CachedResponse, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	tagKey := "cache-tag:" + tag
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, key, data, ttl)
+	pipe.SAdd(ctx, tagKey, key)
+	pipe.Expire(ctx, tagKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisCacheStore) Invalidate(ctx context.Context, tag string) error {
+	tagKey := "cache-tag:" + tag
+	keys, err := s.client.SMembers(ctx, tagKey).Result()
+	if err != nil {
+		return err
+	}
+	return s.client.Del(ctx, append(keys, tagKey)...).Err()
+}
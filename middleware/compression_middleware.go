@@ -1 +1,163 @@
 package middleware
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/gzip"
+)
+
+// CompressionConfig controls which responses Compress encodes.
+type CompressionConfig struct {
+	// MinSize is the smallest body, in bytes, worth compressing.
+	MinSize int
+	// ExcludedTypes are media types, or prefixes ending in "/", that are
+	// already compressed.
+	ExcludedTypes []string
+}
+
+// DefaultCompressionConfig skips bodies under 1 KiB and common binary formats.
+var DefaultCompressionConfig = CompressionConfig{
+	MinSize: 1024,
+	ExcludedTypes: []string{
+		"image/", "video/", "audio/", "font/woff", "font/woff2",
+		"application/pdf", "application/zip", "application/gzip", "application/x-gzip",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/octet-stream",
+	},
+}
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+var (
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, 4) }}
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+// Compress encodes responses with brotli or gzip, whichever the client ranks
+// higher in Accept-Encoding; brotli wins ties. Small bodies, streamed bodies
+// and already-compressed media types are sent as is. Register it outside the
+// response cache so cached entries stay uncompressed.
+func Compress(cfg CompressionConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		c.Vary(fiber.HeaderAcceptEncoding)
+
+		response := c.Response()
+		if c.Method() == fiber.MethodHead || response.IsBodyStream() ||
+			len(response.Header.Peek(fiber.HeaderContentEncoding)) > 0 ||
+			len(response.Body()) < cfg.MinSize ||
+			excludedType(string(response.Header.ContentType()), cfg.ExcludedTypes) {
+			return nil
+		}
+
+		encoding := negotiateEncoding(c.Get(fiber.HeaderAcceptEncoding))
+		if encoding == "" {
+			return nil
+		}
+
+		compressed, err := compressBody(encoding, response.Body())
+		if err != nil {
+			return err
+		}
+
+		response.SetBodyRaw(compressed)
+		response.Header.Set(fiber.HeaderContentEncoding, encoding)
+
+		// The encoded body is a different representation, so a strong ETag
+		// computed over the plain body no longer identifies it byte for byte.
+		if etag := string(response.Header.Peek(fiber.HeaderETag)); etag != "" && !strings.HasPrefix(etag, "W/") {
+			response.Header.Set(fiber.HeaderETag, "W/"+etag)
+		}
+		return nil
+	}
+}
+
+// resettableWriter is implemented by both the brotli and gzip writers.
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	pool := &gzipWriters
+	if encoding == encodingBrotli {
+		pool = &brotliWriters
+	}
+
+	writer := pool.Get().(resettableWriter)
+	defer func() {
+		writer.Reset(io.Discard)
+		pool.Put(writer)
+	}()
+
+	var buf bytes.Buffer
+	buf.Grow(len(body) / 2)
+	writer.Reset(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header,
+// honouring q-values and the "*" wildcard. It returns "" when neither is
+// acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if key, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if name == "*" {
+			wildcard = quality
+		} else {
+			qualities[name] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		quality, listed := qualities[encoding]
+		if !listed {
+			quality = wildcard
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+func excludedType(contentType string, excluded []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, candidate := range excluded {
+		if strings.HasSuffix(candidate, "/") && strings.HasPrefix(mediaType, candidate) || mediaType == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -1 +1,101 @@
 package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Bradkibs/MONOS-challenge/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+const (
+	defaultCORSMethods       = "GET,HEAD,POST,PUT,PATCH,DELETE"
+	defaultCORSHeaders       = "Origin,Accept,Content-Type,Authorization,X-Request-ID,X-CSRF-Token"
+	defaultCORSExposeHeaders = "X-Request-ID,ETag,Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset"
+	defaultCORSMaxAge        = 600
+)
+
+// CORSConfigFromEnv builds the cross-origin policy from the CORS_* variables:
+//
+//	CORS_ALLOWED_ORIGINS    comma-separated origins, "*" for any; empty denies all cross-origin requests
+//	CORS_ALLOWED_METHODS    defaults to GET,HEAD,POST,PUT,PATCH,DELETE
+//	CORS_ALLOWED_HEADERS    request headers browsers may send
+//	CORS_EXPOSE_HEADERS     response headers scripts may read
+//	CORS_ALLOW_CREDENTIALS  "true" to allow cookies; requires explicit origins
+//	CORS_MAX_AGE            seconds browsers may cache a preflight response
+func CORSConfigFromEnv() (cors.Config, error) {
+	origins := splitList(config.Getenv("CORS_ALLOWED_ORIGINS", ""))
+	for _, origin := range origins {
+		if err := validateOrigin(origin); err != nil {
+			return cors.Config{}, err
+		}
+	}
+
+	allowCredentials, err := strconv.ParseBool(config.Getenv("CORS_ALLOW_CREDENTIALS", "false"))
+	if err != nil {
+		return cors.Config{}, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS: %w", err)
+	}
+	if allowCredentials && slices.Contains(origins, "*") {
+		return cors.Config{}, errors.New("CORS_ALLOW_CREDENTIALS cannot be combined with a wildcard CORS_ALLOWED_ORIGINS")
+	}
+
+	maxAge, err := strconv.Atoi(config.Getenv("CORS_MAX_AGE", strconv.Itoa(defaultCORSMaxAge)))
+	if err != nil || maxAge < 0 {
+		return cors.Config{}, fmt.Errorf("invalid CORS_MAX_AGE %q", config.Getenv("CORS_MAX_AGE", ""))
+	}
+
+	cfg := cors.Config{
+		AllowOrigins:     strings.Join(origins, ","),
+		AllowMethods:     strings.Join(splitList(config.Getenv("CORS_ALLOWED_METHODS", defaultCORSMethods)), ","),
+		AllowHeaders:     strings.Join(splitList(config.Getenv("CORS_ALLOWED_HEADERS", defaultCORSHeaders)), ","),
+		ExposeHeaders:    strings.Join(splitList(config.Getenv("CORS_EXPOSE_HEADERS", defaultCORSExposeHeaders)), ","),
+		AllowCredentials: allowCredentials,
+		MaxAge:           maxAge,
+	}
+
+	// Without configured origins fiber would fall back to "*"; refuse every
+	// origin instead so production is closed unless explicitly opened up.
+	if len(origins) == 0 {
+		cfg.AllowOriginsFunc = func(string) bool { return false }
+	}
+
+	return cfg, nil
+}
+
+// CORS answers preflight requests and sets the Access-Control-* headers
+// according to cfg. Register it ahead of authentication and rate limiting so
+// preflights are never rejected for lacking credentials.
+func CORS(cfg cors.Config) fiber.Handler {
+	return cors.New(cfg)
+}
+
+// validateOrigin accepts "*" or a bare scheme://host[:port] origin.
+func validateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		(parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid origin %q in CORS_ALLOWED_ORIGINS, expected scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated setting, dropping blanks and a trailing
+// slash on origins.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSuffix(strings.TrimSpace(item), "/")
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
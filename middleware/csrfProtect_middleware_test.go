@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var testCSRFSecret = []byte("csrf-test-secret")
+
+func TestValidCSRFToken(t *testing.T) {
+	token, err := newCSRFToken(testCSRFSecret, "session-a")
+	if err != nil {
+		t.Fatalf("newCSRFToken: %v", err)
+	}
+	nonce, mac, _ := strings.Cut(token, ".")
+	other, err := newCSRFToken(testCSRFSecret, "session-a")
+	if err != nil {
+		t.Fatalf("newCSRFToken: %v", err)
+	}
+	otherNonce, _, _ := strings.Cut(other, ".")
+	tampered := "A" + mac[1:]
+	if mac[0] == 'A' {
+		tampered = "B" + mac[1:]
+	}
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		token   string
+		session string
+		want    bool
+	}{
+		{"valid", testCSRFSecret, token, "session-a", true},
+		{"other session", testCSRFSecret, token, "session-b", false},
+		{"other secret", []byte("another-secret"), token, "session-a", false},
+		{"nonce swapped", testCSRFSecret, otherNonce + "." + mac, "session-a", false},
+		{"mac tampered", testCSRFSecret, nonce + "." + tampered, "session-a", false},
+		{"no separator", testCSRFSecret, nonce + mac, "session-a", false},
+		{"empty nonce", testCSRFSecret, "." + mac, "session-a", false},
+		{"empty", testCSRFSecret, "", "session-a", false},
+	}
+	for _, tt := range tests {
+		if got := validCSRFToken(tt.secret, tt.token, tt.session); got != tt.want {
+			t.Errorf("%s: validCSRFToken = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCSRFProtect(t *testing.T) {
+	app := fiber.New()
+	app.Use(CSRFProtect(testCSRFSecret))
+	app.All("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	token, err := newCSRFToken(testCSRFSecret, "session-a")
+	if err != nil {
+		t.Fatalf("newCSRFToken: %v", err)
+	}
+	otherToken, err := newCSRFToken(testCSRFSecret, "session-b")
+	if err != nil {
+		t.Fatalf("newCSRFToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		session string
+		cookie  string
+		header  string
+		bearer  bool
+		want    int
+	}{
+		{"safe method without token", fiber.MethodGet, "session-a", "", "", false, fiber.StatusNoContent},
+		{"head without token", fiber.MethodHead, "session-a", "", "", false, fiber.StatusNoContent},
+		{"options without token", fiber.MethodOptions, "session-a", "", "", false, fiber.StatusNoContent},
+		{"post without session", fiber.MethodPost, "", "", "", false, fiber.StatusNoContent},
+		{"post with bearer token", fiber.MethodPost, "session-a", "", "", true, fiber.StatusNoContent},
+		{"post with matching token", fiber.MethodPost, "session-a", token, token, false, fiber.StatusNoContent},
+		{"post without header", fiber.MethodPost, "session-a", token, "", false, fiber.StatusForbidden},
+		{"post without cookie", fiber.MethodPost, "session-a", "", token, false, fiber.StatusForbidden},
+		{"header differs from cookie", fiber.MethodPost, "session-a", token, otherToken, false, fiber.StatusForbidden},
+		{"token of another session", fiber.MethodDelete, "session-a", otherToken, otherToken, false, fiber.StatusForbidden},
+		{"unsigned token", fiber.MethodPut, "session-a", "nonce.mac", "nonce.mac", false, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.session})
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.bearer {
+				req.Header.Set(fiber.HeaderAuthorization, "Bearer token")
+			}
+			if resp := testRequest(t, app, req); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFProtectIssuesTokenForSession(t *testing.T) {
+	app := fiber.New()
+	app.Use(CSRFProtect(testCSRFSecret))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookie, Value: "session-a"})
+	resp := testRequest(t, app, req)
+
+	var issued string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == CSRFCookie {
+			issued = cookie.Value
+		}
+	}
+	if !validCSRFToken(testCSRFSecret, issued, "session-a") {
+		t.Fatalf("issued CSRF cookie %q is not valid for the session", issued)
+	}
+}
@@ -1 +1,98 @@
 package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// ErrorResponse is the JSON envelope returned for every failed request.
+type ErrorResponse struct {
+	Error     string                 `json:"error"`
+	Message   string                 `json:"message"`
+	Fields    []apperrors.FieldError `json:"fields,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// ErrorHandler is the application-wide fiber.ErrorHandler. Domain errors from
+// the apperrors package are mapped to their status code and client-safe
+// message; anything else is logged and reported as a generic 500 so database
+// and driver details never reach the client.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	code := ""
+	message := "internal server error"
+
+	var fiberErr *fiber.Error
+	switch {
+	case errors.Is(err, apperrors.ErrNotFound):
+		status, code = fiber.StatusNotFound, "not_found"
+	case errors.Is(err, apperrors.ErrConflict):
+		status, code = fiber.StatusConflict, "conflict"
+	case errors.Is(err, apperrors.ErrValidation):
+		status, code = fiber.StatusBadRequest, "validation_failed"
+	case errors.Is(err, apperrors.ErrUnauthorized):
+		status, code = fiber.StatusUnauthorized, "unauthorized"
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	case errors.Is(err, apperrors.ErrForbidden):
+		status, code = fiber.StatusForbidden, "forbidden"
+	case errors.Is(err, apperrors.ErrPaymentDeclined):
+		status, code = fiber.StatusPaymentRequired, "payment_declined"
+	case errors.Is(err, apperrors.ErrTooManyRequests):
+		status = fiber.StatusTooManyRequests
+	case errors.As(err, &fiberErr):
+		status = fiberErr.Code
+		if status < fiber.StatusInternalServerError {
+			message = fiberErr.Message
+		}
+	}
+
+	if appMessage, ok := apperrors.Message(err); ok {
+		message = appMessage
+	}
+
+	if status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(c.UserContext(), "request failed",
+			slog.String("http.request.id", requestID(c)),
+			slog.String("http.request.method", c.Method()),
+			slog.String("url.path", c.Path()),
+			logging.Err(err),
+		)
+	}
+
+	return c.Status(status).JSON(ErrorResponse{
+		Error:     errorCode(status, code),
+		Message:   message,
+		Fields:    apperrors.Fields(err),
+		RequestID: requestID(c),
+	})
+}
+
+// writeError renders the standard error envelope for middleware that answers
+// requests directly instead of returning an error.
+func writeError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(ErrorResponse{
+		Error:     errorCode(status, code),
+		Message:   message,
+		RequestID: requestID(c),
+	})
+}
+
+// errorCode returns code, or derives one from the status text when it is
+// empty, e.g. 404 becomes "not_found".
+func errorCode(status int, code string) string {
+	if code != "" {
+		return code
+	}
+	return strings.ToLower(strings.ReplaceAll(utils.StatusMessage(status), " ", "_"))
+}
+
+// requestID returns the ID assigned by the requestid middleware.
+func requestID(c *fiber.Ctx) string {
+	return c.GetRespHeader(fiber.HeaderXRequestID)
+}
@@ -1 +1,135 @@
 package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const clientIPKey = "client_ip"
+
+// CIDRList is a set of IPv4 and IPv6 networks.
+type CIDRList []netip.Prefix
+
+// ParseCIDRList parses a comma-separated list of CIDR blocks or single
+// addresses, e.g. "10.0.0.0/8, 2001:db8::/32, 203.0.113.7".
+func ParseCIDRList(value string) (CIDRList, error) {
+	var list CIDRList
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			list = append(list, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		list = append(list, prefix.Masked())
+	}
+	return list, nil
+}
+
+// Contains reports whether addr belongs to one of the networks. IPv4-mapped
+// IPv6 addresses are matched as IPv4.
+func (l CIDRList) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustProxies resolves the real client address for requests relayed by the
+// load balancer. X-Forwarded-For is only honoured when the direct peer is in
+// trusted, and is read right to left so that entries a client prepends
+// itself are never reached: the first hop that is not a trusted proxy is the
+// client. Register it before anything that calls ClientIP.
+func TrustProxies(trusted CIDRList) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(clientIPKey, resolveClientIP(c, trusted))
+		return c.Next()
+	}
+}
+
+func resolveClientIP(c *fiber.Ctx, trusted CIDRList) netip.Addr {
+	client, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok {
+		return netip.Addr{}
+	}
+	client = client.Unmap()
+
+	if !trusted.Contains(client) {
+		return client
+	}
+
+	hops := strings.Split(c.Get(fiber.HeaderXForwardedFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed entry ends the chain; the last trusted hop is the
+			// best we know.
+			break
+		}
+		client = hop.Unmap()
+		if !trusted.Contains(client) {
+			break
+		}
+	}
+	return client
+}
+
+// ClientIP returns the client address resolved by TrustProxies, or the
+// direct peer address when TrustProxies is not in the chain.
+func ClientIP(c *fiber.Ctx) string {
+	if addr, ok := c.Locals(clientIPKey).(netip.Addr); ok && addr.IsValid() {
+		return addr.String()
+	}
+	return c.IP()
+}
+
+// AllowIPs rejects requests whose client address is outside allowed.
+func AllowIPs(allowed CIDRList) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !clientAllowed(c, allowed) {
+			return apperrors.Forbidden("access is not allowed from this network")
+		}
+		return c.Next()
+	}
+}
+
+// RestrictAdminNetworks rejects requests carrying an admin token unless
+// they come from allowed, so admin privileges cannot be used from outside
+// the office or VPN networks even with a stolen token. It runs app-wide,
+// ahead of route-level authentication, and ignores invalid tokens, which
+// Authenticate rejects later.
+func RestrictAdminNetworks(allowed CIDRList) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := requestClaims(c)
+		if ok && claims.Role == models.RoleAdmin && !clientAllowed(c, allowed) {
+			return apperrors.Forbidden("admin access is not allowed from this network")
+		}
+		return c.Next()
+	}
+}
+
+func clientAllowed(c *fiber.Ctx, allowed CIDRList) bool {
+	addr, err := netip.ParseAddr(ClientIP(c))
+	return err == nil && allowed.Contains(addr)
+}
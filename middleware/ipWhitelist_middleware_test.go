@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// clientIPApp echoes ClientIP. app.Test connects from 0.0.0.0, so listing
+// that address in trusted makes the test client a trusted proxy.
+func clientIPApp(t *testing.T, trusted string, handlers ...fiber.Handler) *fiber.App {
+	t.Helper()
+	networks, err := ParseCIDRList(trusted)
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(TrustProxies(networks))
+	for _, handler := range handlers {
+		app.Use(handler)
+	}
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(ClientIP(c))
+	})
+	return app
+}
+
+func TestTrustProxiesResolvesClientIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trusted      string
+		forwardedFor string
+		wantClientIP string
+	}{
+		{"untrusted peer ignores header", "10.0.0.0/8", "203.0.113.5", "0.0.0.0"},
+		{"untrusted peer ignores spoofed internal hop", "10.0.0.0/8", "10.0.0.2", "0.0.0.0"},
+		{"trusted peer without header", "0.0.0.0/32", "", "0.0.0.0"},
+		{"trusted peer", "0.0.0.0/32", "203.0.113.5", "203.0.113.5"},
+		{"client-prepended entry is skipped", "0.0.0.0/32", "198.51.100.1, 203.0.113.5", "203.0.113.5"},
+		{"chain of trusted proxies", "0.0.0.0/32, 10.0.0.0/8", "203.0.113.5, 10.0.0.3, 10.0.0.2", "203.0.113.5"},
+		{"spoof behind trusted proxies", "0.0.0.0/32, 10.0.0.0/8", "198.51.100.1, 203.0.113.5, 10.0.0.2", "203.0.113.5"},
+		{"only trusted hops", "0.0.0.0/32, 10.0.0.0/8", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"malformed last hop", "0.0.0.0/32", "203.0.113.5, not-an-ip", "0.0.0.0"},
+		{"malformed hop before client", "0.0.0.0/32", "not-an-ip, 203.0.113.5", "203.0.113.5"},
+		{"malformed hop behind trusted proxy", "0.0.0.0/32, 10.0.0.0/8", "203.0.113.5, bogus, 10.0.0.2", "10.0.0.2"},
+		{"address with port", "0.0.0.0/32", "203.0.113.5:4000", "0.0.0.0"},
+		{"empty entries", "0.0.0.0/32", ", ,", "0.0.0.0"},
+		{"ipv4-mapped ipv6", "0.0.0.0/32", "::ffff:203.0.113.5", "203.0.113.5"},
+		{"ipv6", "0.0.0.0/32", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := clientIPApp(t, tt.trusted)
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.forwardedFor != "" {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+			}
+			resp := testRequest(t, app, req)
+			body, _ := io.ReadAll(resp.Body)
+			if got := string(body); got != tt.wantClientIP {
+				t.Errorf("ClientIP = %q, want %q", got, tt.wantClientIP)
+			}
+		})
+	}
+}
+
+func TestAllowIPsRejectsSpoofedForwardedFor(t *testing.T) {
+	allowed, err := ParseCIDRList("198.51.100.0/24")
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		trusted      string
+		forwardedFor string
+		want         int
+	}{
+		{"allowed client behind proxy", "0.0.0.0/32", "198.51.100.7", fiber.StatusOK},
+		{"allowed address prepended by client", "0.0.0.0/32", "198.51.100.7, 203.0.113.5", fiber.StatusForbidden},
+		{"allowed address from untrusted peer", "10.0.0.0/8", "198.51.100.7", fiber.StatusForbidden},
+		{"malformed chain", "0.0.0.0/32", "198.51.100.7, bogus", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := clientIPApp(t, tt.trusted, AllowIPs(allowed))
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderXForwardedFor, tt.forwardedFor)
+			if resp := testRequest(t, app, req); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRList(t *testing.T) {
+	list, err := ParseCIDRList(" 10.1.2.3/8, 2001:db8::/32 ,203.0.113.7,, ::ffff:192.0.2.1")
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "2001:db8::/32", "203.0.113.7/32", "192.0.2.1/32"}
+	if len(list) != len(want) {
+		t.Fatalf("got %v, want %v", list, want)
+	}
+	for i, prefix := range list {
+		if prefix.String() != want[i] {
+			t.Errorf("entry %d = %s, want %s", i, prefix, want[i])
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "example.com", "10.0.0.1/8/8"} {
+		if _, err := ParseCIDRList(invalid); err == nil {
+			t.Errorf("ParseCIDRList(%q) succeeded, want an error", invalid)
+		}
+	}
+}
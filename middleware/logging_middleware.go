@@ -1 +1,51 @@
 package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestLogger writes one structured record per request using ECS field
+// names. Errors returned further down the chain are rendered by the app's
+// ErrorHandler first so the logged status matches what the client received.
+// Register it after requestid and before recover.
+func RequestLogger(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if chainErr := c.Next(); chainErr != nil {
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("http.request.id", requestID(c)),
+			slog.String("http.request.method", c.Method()),
+			slog.String("url.path", c.Path()),
+			slog.String("http.route", c.Route().Path),
+			slog.Int("http.response.status_code", status),
+			slog.Int("http.response.body.bytes", len(c.Response().Body())),
+			slog.Int64("event.duration", time.Since(start).Nanoseconds()),
+			slog.String("client.ip", ClientIP(c)),
+			slog.String("user_agent.original", c.Get(fiber.HeaderUserAgent)),
+		}
+		if claims, ok := GetClaims(c); ok {
+			attrs = append(attrs, slog.String("user.id", claims.UserID.String()), slog.String("user.roles", claims.Role))
+		}
+
+		logger.LogAttrs(c.UserContext(), level, c.Method()+" "+c.Path(), attrs...)
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IDLocator extracts the identifier of the resource a request acts on.
+type IDLocator func(c *fiber.Ctx) (string, error)
+
+// Keys under which BodyID and QueryID keep the DTO they bound.
+const (
+	boundBodyKey  = "boundBody"
+	boundQueryKey = "boundQuery"
+)
+
+// ParamID reads the resource ID from a route parameter.
+func ParamID(name string) IDLocator {
+	return func(c *fiber.Ctx) (string, error) {
+		return c.Params(name), nil
+	}
+}
+
+// QueryID binds the query string into the handler's DTO and returns the ID
+// that id picks from it. The handler reads the same DTO back with
+// BoundQuery, so repeated keys cannot make the check and the handler see
+// different values.
+func QueryID[T any](id func(*T) string) IDLocator {
+	return func(c *fiber.Ctx) (string, error) {
+		dto := new(T)
+		if err := BindQuery(c, dto); err != nil {
+			return "", err
+		}
+		c.Locals(boundQueryKey, dto)
+		return id(dto), nil
+	}
+}
+
+// BodyID binds the body into the handler's DTO and returns the ID that id
+// picks from it. The handler reads the same DTO back with BoundBody, so keys
+// that differ only in case cannot make the check and the handler see
+// different values.
+func BodyID[T any](id func(*T) string) IDLocator {
+	return func(c *fiber.Ctx) (string, error) {
+		dto := new(T)
+		if err := BindBody(c, dto); err != nil {
+			return "", err
+		}
+		c.Locals(boundBodyKey, dto)
+		return id(dto), nil
+	}
+}
+
+// BoundBody returns the body DTO bound by BodyID, or binds it when no
+// ownership check ran.
+func BoundBody[T any](c *fiber.Ctx) (*T, error) {
+	if dto, ok := c.Locals(boundBodyKey).(*T); ok {
+		return dto, nil
+	}
+	dto := new(T)
+	if err := BindBody(c, dto); err != nil {
+		return nil, err
+	}
+	return dto, nil
+}
+
+// BoundQuery returns the query DTO bound by QueryID, or binds it when no
+// ownership check ran.
+func BoundQuery[T any](c *fiber.Ctx) (*T, error) {
+	if dto, ok := c.Locals(boundQueryKey).(*T); ok {
+		return dto, nil
+	}
+	dto := new(T)
+	if err := BindQuery(c, dto); err != nil {
+		return nil, err
+	}
+	return dto, nil
+}
+
+// RequireOwnership ensures the authenticated vendor owns the resource located
+// by locate. Admins bypass the check. It must run after Authenticate.
+func RequireOwnership(db *pgxpool.Pool, kind services.ResourceKind, locate IDLocator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := GetClaims(c)
+		if !ok {
+			return apperrors.Unauthorized("authentication required")
+		}
+
+		// The ID is located for admins too so the handler always finds the
+		// bound DTO.
+		located, err := locate(c)
+		if err != nil {
+			return err
+		}
+		if claims.Role == models.RoleAdmin {
+			return c.Next()
+		}
+
+		resourceID, err := uuid.Parse(located)
+		if err != nil {
+			return apperrors.Validation(fmt.Sprintf("invalid %s ID", kind))
+		}
+
+		ownerID, err := services.GetResourceOwner(kind, resourceID, db)
+		if errors.Is(err, apperrors.ErrNotFound) {
+			return apperrors.NotFound(fmt.Sprintf("%s not found", kind))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to verify %s ownership: %w", kind, err)
+		}
+
+		if ownerID != claims.UserID {
+			return apperrors.Forbidden(fmt.Sprintf("%s does not belong to you", kind))
+		}
+
+		return c.Next()
+	}
+}
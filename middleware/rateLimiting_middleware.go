@@ -1 +1,177 @@
 package middleware
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitPolicy describes the request budget for a group of routes.
+type RateLimitPolicy struct {
+	// Name namespaces the counters so policies never share a budget.
+	Name   string
+	Max    int
+	Window time.Duration
+	// Skip, when set, exempts matching requests from the policy.
+	Skip func(c *fiber.Ctx) bool
+	// Key identifies the caller a budget belongs to; UserOrIPKey when nil.
+	Key func(c *fiber.Ctx) string
+}
+
+var (
+	// LoginRateLimit slows down credential brute-forcing on /auth/login/* and
+	// /auth/mfa/verify. It is keyed by IP: a token of an attacker's own
+	// account must not buy a fresh budget against someone else's.
+	LoginRateLimit = RateLimitPolicy{Name: "login", Max: 5, Window: 15 * time.Minute, Key: ClientIPKey}
+	// PasswordResetRateLimit limits reset messages and token guessing on
+	// /auth/password/forgot/* and /auth/password/reset.
+	PasswordResetRateLimit = RateLimitPolicy{Name: "password_reset", Max: 5, Window: 15 * time.Minute, Key: ClientIPKey}
+	// PaymentRateLimit guards the payment gateway from repeated charges.
+	PaymentRateLimit = RateLimitPolicy{Name: "payment", Max: 10, Window: time.Hour}
+	// ReadRateLimit is the general budget for directory browsing.
+	ReadRateLimit = RateLimitPolicy{
+		Name:   "read",
+		Max:    300,
+		Window: time.Minute,
+		Skip: func(c *fiber.Ctx) bool {
+			return c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead
+		},
+	}
+)
+
+// RateLimitStore counts hits per key within a fixed window.
+type RateLimitStore interface {
+	// Increment records a hit for key and returns the number of hits in the
+	// current window together with the time left until the window resets.
+	Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+}
+
+// RateLimit enforces policy using store. Callers are identified by the
+// policy's Key function.
+func RateLimit(store RateLimitStore, policy RateLimitPolicy) fiber.Handler {
+	limit := strconv.Itoa(policy.Max)
+	identify := policy.Key
+	if identify == nil {
+		identify = UserOrIPKey
+	}
+
+	return func(c *fiber.Ctx) error {
+		if policy.Skip != nil && policy.Skip(c) {
+			return c.Next()
+		}
+
+		key := "ratelimit:" + policy.Name + ":" + identify(c)
+		count, resetIn, err := store.Increment(c.UserContext(), key, policy.Window)
+		if err != nil {
+			// Fail open: an unavailable store must not take the API down with it.
+			slog.Warn("rate limit store error", slog.String("rate_limit.key", key), logging.Err(err))
+			return c.Next()
+		}
+
+		resetSeconds := strconv.Itoa(int((resetIn + time.Second - 1) / time.Second))
+		c.Set("RateLimit-Limit", limit)
+		c.Set("RateLimit-Remaining", strconv.Itoa(max(policy.Max-count, 0)))
+		c.Set("RateLimit-Reset", resetSeconds)
+
+		if count > policy.Max {
+			c.Set(fiber.HeaderRetryAfter, resetSeconds)
+			return writeError(c, fiber.StatusTooManyRequests, "", "rate limit exceeded, retry after "+resetSeconds+" seconds")
+		}
+
+		return c.Next()
+	}
+}
+
+// UserOrIPKey identifies callers by their user ID when they present a valid
+// token and by client IP otherwise.
+func UserOrIPKey(c *fiber.Ctx) string {
+	if claims, ok := requestClaims(c); ok {
+		return "user:" + claims.UserID.String()
+	}
+	return ClientIPKey(c)
+}
+
+// ClientIPKey identifies callers by client IP only, whatever token they
+// send.
+func ClientIPKey(c *fiber.Ctx) string {
+	return "ip:" + ClientIP(c)
+}
+
+// MemoryRateLimitStore keeps counters in process memory. It is meant for
+// tests and single-instance development setups.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	nextSweep time.Time
+}
+
+type rateLimitEntry struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*rateLimitEntry)}
+}
+
+func (s *MemoryRateLimitStore) Increment(_ context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextSweep) {
+		for k, entry := range s.entries {
+			if !now.Before(entry.resetAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.resetAt) {
+		entry = &rateLimitEntry{resetAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+
+	return entry.count, entry.resetAt.Sub(now), nil
+}
+
+// RedisRateLimitStore shares counters between API instances through Redis.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+// incrementScript starts the window expiry on the first hit so INCR and
+// PEXPIRE happen atomically.
+var incrementScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}
+`)
+
+func (s *RedisRateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	result, err := incrementScript.Run(ctx, s.client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ttl := time.Duration(result[1]) * time.Millisecond
+	if ttl < 0 {
+		ttl = window
+	}
+	return int(result[0]), ttl, nil
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+func TestMemoryRateLimitStoreCountsWithinWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		count, resetIn, err := store.Increment(ctx, "key", time.Minute)
+		if err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+		if count != want {
+			t.Fatalf("count = %d, want %d", count, want)
+		}
+		if resetIn <= 0 || resetIn > time.Minute {
+			t.Fatalf("resetIn = %v, want within (0, 1m]", resetIn)
+		}
+	}
+
+	if count, _, _ := store.Increment(ctx, "other", time.Minute); count != 1 {
+		t.Fatalf("other key count = %d, want 1", count)
+	}
+}
+
+func TestMemoryRateLimitStoreWindowExpires(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	window := 50 * time.Millisecond
+
+	store.Increment(ctx, "key", window)
+	store.Increment(ctx, "key", window)
+	time.Sleep(window + 10*time.Millisecond)
+
+	count, resetIn, err := store.Increment(ctx, "key", window)
+	if err != nil {
+		t.Fatalf("Increment: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("count after window = %d, want 1", count)
+	}
+	if resetIn <= 0 || resetIn > window {
+		t.Fatalf("resetIn = %v, want a fresh window", resetIn)
+	}
+}
+
+// rateLimitApp trusts the test client address as a proxy so X-Forwarded-For
+// chooses the client IP, and turns X-Test-User into claims.
+func rateLimitApp(t *testing.T, store RateLimitStore, policy RateLimitPolicy) *fiber.App {
+	t.Helper()
+	trusted, err := ParseCIDRList("0.0.0.0/32")
+	if err != nil {
+		t.Fatalf("ParseCIDRList: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(TrustProxies(trusted))
+	app.Use(func(c *fiber.Ctx) error {
+		if user := c.Get("X-Test-User"); user != "" {
+			c.Locals(ClaimsKey, &models.Claims{UserID: uuid.MustParse(user)})
+		}
+		return c.Next()
+	})
+	app.Use(RateLimit(store, policy))
+	app.All("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func doRateLimited(t *testing.T, app *fiber.App, method, ip, user string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set(fiber.HeaderXForwardedFor, ip)
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	return testRequest(t, app, req)
+}
+
+func testRequest(t *testing.T, app *fiber.App, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	return resp
+}
+
+func TestRateLimitHeadersAndRejection(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Max: 2, Window: time.Minute}
+	app := rateLimitApp(t, NewMemoryRateLimitStore(), policy)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		resp := doRateLimited(t, app, fiber.MethodGet, "203.0.113.1", "")
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want 204", i+1, resp.StatusCode)
+		}
+		if got := resp.Header.Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 2", i+1, got)
+		}
+		if got := resp.Header.Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %s", i+1, got, wantRemaining)
+		}
+		if reset, err := strconv.Atoi(resp.Header.Get("RateLimit-Reset")); err != nil || reset < 1 || reset > 60 {
+			t.Errorf("request %d: RateLimit-Reset = %q, want 1..60", i+1, resp.Header.Get("RateLimit-Reset"))
+		}
+		if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "" {
+			t.Errorf("request %d: Retry-After = %q, want none", i+1, got)
+		}
+	}
+
+	resp := doRateLimited(t, app, fiber.MethodGet, "203.0.113.1", "")
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", resp.StatusCode)
+	}
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderRetryAfter); got != resp.Header.Get("RateLimit-Reset") || got == "" {
+		t.Errorf("Retry-After = %q, want RateLimit-Reset %q", got, resp.Header.Get("RateLimit-Reset"))
+	}
+}
+
+func TestRateLimitKeysByUserOrIP(t *testing.T) {
+	policy := RateLimitPolicy{Name: "test", Max: 1, Window: time.Minute}
+	app := rateLimitApp(t, NewMemoryRateLimitStore(), policy)
+	user := uuid.NewString()
+
+	steps := []struct {
+		name string
+		ip   string
+		user string
+		want int
+	}{
+		{"first ip", "203.0.113.1", "", fiber.StatusNoContent},
+		{"same ip again", "203.0.113.1", "", fiber.StatusTooManyRequests},
+		{"other ip", "203.0.113.2", "", fiber.StatusNoContent},
+		{"user on exhausted ip", "203.0.113.1", user, fiber.StatusNoContent},
+		{"same user from other ip", "203.0.113.3", user, fiber.StatusTooManyRequests},
+		{"other user", "203.0.113.3", uuid.NewString(), fiber.StatusNoContent},
+	}
+	for _, step := range steps {
+		resp := doRateLimited(t, app, fiber.MethodGet, step.ip, step.user)
+		if resp.StatusCode != step.want {
+			t.Errorf("%s: status = %d, want %d", step.name, resp.StatusCode, step.want)
+		}
+	}
+}
+
+func TestRateLimitSkip(t *testing.T) {
+	app := rateLimitApp(t, NewMemoryRateLimitStore(), RateLimitPolicy{
+		Name:   "read",
+		Max:    1,
+		Window: time.Minute,
+		Skip:   ReadRateLimit.Skip,
+	})
+
+	for i := 0; i < 3; i++ {
+		resp := doRateLimited(t, app, fiber.MethodPost, "203.0.113.1", "")
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("POST %d: status = %d, want 204", i+1, resp.StatusCode)
+		}
+		if got := resp.Header.Get("RateLimit-Limit"); got != "" {
+			t.Fatalf("POST %d: RateLimit-Limit = %q, want none for skipped requests", i+1, got)
+		}
+	}
+}
+
+// bearerToken signs an access token for a fresh user the way the auth
+// service does.
+func bearerToken(t *testing.T) string {
+	t.Helper()
+	now := time.Now()
+	claims := &models.Claims{ID: uuid.New(), UserID: uuid.New(), IssuedAt: now, ExpiresAt: now.Add(time.Minute), Role: models.RoleUser}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestLoginRateLimitIgnoresBearerTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret-test")
+	app := rateLimitApp(t, NewMemoryRateLimitStore(), LoginRateLimit)
+
+	for i := 1; i <= LoginRateLimit.Max+1; i++ {
+		req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.1")
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+bearerToken(t))
+		resp := testRequest(t, app, req)
+
+		want := fiber.StatusNoContent
+		if i > LoginRateLimit.Max {
+			want = fiber.StatusTooManyRequests
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("attempt %d with a new account's token: status = %d, want %d", i, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestUserOrIPKeyUsesBearerToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret-test")
+	app := rateLimitApp(t, NewMemoryRateLimitStore(), RateLimitPolicy{Name: "test", Max: 1, Window: time.Minute})
+
+	for i := 1; i <= 3; i++ {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, "203.0.113.1")
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+bearerToken(t))
+		if resp := testRequest(t, app, req); resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want each user to get its own budget", i, resp.StatusCode)
+		}
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Increment(context.Context, string, time.Duration) (int, time.Duration, error) {
+	return 0, 0, errors.New("store unavailable")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	app := rateLimitApp(t, failingRateLimitStore{}, RateLimitPolicy{Name: "test", Max: 1, Window: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if resp := doRateLimited(t, app, fiber.MethodGet, "203.0.113.1", ""); resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want 204", i+1, resp.StatusCode)
+		}
+	}
+}
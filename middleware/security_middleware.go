@@ -1 +1,134 @@
 package middleware
+
+import (
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SecurityPolicy lists the protective response headers and the request
+// constraints applied to a group of routes. Empty header values are not sent.
+type SecurityPolicy struct {
+	// HSTSMaxAge is in seconds and only sent over HTTPS; zero disables HSTS.
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	ContentSecurityPolicy string
+	FrameOptions          string
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	// MaxBodySize is in bytes; zero leaves only fiber's global BodyLimit.
+	MaxBodySize int
+	// ContentTypes are the media types accepted for request bodies; empty
+	// accepts anything.
+	ContentTypes []string
+}
+
+// DefaultSecurityPolicy suits the JSON API: nothing may be framed, scripted or
+// sniffed, and bodies must be JSON of at most 1 MiB.
+var DefaultSecurityPolicy = SecurityPolicy{
+	HSTSMaxAge:            63072000,
+	HSTSIncludeSubdomains: true,
+	ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+	FrameOptions:          "DENY",
+	ReferrerPolicy:        "no-referrer",
+	PermissionsPolicy:     "camera=(), microphone=(), geolocation=(), payment=()",
+	MaxBodySize:           1 << 20,
+	ContentTypes:          []string{fiber.MIMEApplicationJSON},
+}
+
+// WebhookSecurityPolicy is the default policy with a lower body limit for
+// payment gateway callbacks, which are small JSON documents.
+var WebhookSecurityPolicy = func() SecurityPolicy {
+	policy := DefaultSecurityPolicy
+	policy.MaxBodySize = 64 << 10
+	return policy
+}()
+
+// RouteSecurityPolicy replaces the default policy for requests whose path
+// matches Pattern. Patterns use fiber route syntax: ":name" matches a single
+// segment and a trailing "*" matches the rest of the path. An empty Method
+// matches every method.
+type RouteSecurityPolicy struct {
+	Method  string
+	Pattern string
+	Policy  SecurityPolicy
+}
+
+// Security sets the security headers of the matching policy on every
+// response and rejects request bodies that are too large (413) or not of an
+// accepted media type (415). The first matching override wins.
+func Security(policy SecurityPolicy, overrides ...RouteSecurityPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		active := policy
+		for _, override := range overrides {
+			if (override.Method == "" || override.Method == c.Method()) && matchRoute(override.Pattern, c.Path()) {
+				active = override.Policy
+				break
+			}
+		}
+
+		active.setHeaders(c)
+
+		body := c.Request().Body()
+		if active.MaxBodySize > 0 && (len(body) > active.MaxBodySize || c.Request().Header.ContentLength() > active.MaxBodySize) {
+			return writeError(c, fiber.StatusRequestEntityTooLarge, "", "request body exceeds "+strconv.Itoa(active.MaxBodySize)+" bytes")
+		}
+
+		if len(body) > 0 && len(active.ContentTypes) > 0 {
+			mediaType, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+			if err != nil || !slices.Contains(active.ContentTypes, mediaType) {
+				return writeError(c, fiber.StatusUnsupportedMediaType, "", "content type must be one of: "+strings.Join(active.ContentTypes, ", "))
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func (p SecurityPolicy) setHeaders(c *fiber.Ctx) {
+	if p.HSTSMaxAge > 0 && c.Protocol() == "https" {
+		hsts := "max-age=" + strconv.Itoa(p.HSTSMaxAge)
+		if p.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if p.HSTSPreload {
+			hsts += "; preload"
+		}
+		c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+	}
+
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	setIfNotEmpty(c, fiber.HeaderContentSecurityPolicy, p.ContentSecurityPolicy)
+	setIfNotEmpty(c, fiber.HeaderXFrameOptions, p.FrameOptions)
+	setIfNotEmpty(c, fiber.HeaderReferrerPolicy, p.ReferrerPolicy)
+	setIfNotEmpty(c, fiber.HeaderPermissionsPolicy, p.PermissionsPolicy)
+}
+
+func setIfNotEmpty(c *fiber.Ctx, header, value string) {
+	if value != "" {
+		c.Set(header, value)
+	}
+}
+
+// matchRoute reports whether path matches a fiber-style route pattern.
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
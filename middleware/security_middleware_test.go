@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWebhookSecurityPolicyOverride(t *testing.T) {
+	app := fiber.New()
+	app.Use(Security(DefaultSecurityPolicy,
+		RouteSecurityPolicy{Method: fiber.MethodPost, Pattern: "/webhooks/*", Policy: WebhookSecurityPolicy},
+	))
+	app.Post("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	large := `{"padding":"` + strings.Repeat("x", 64<<10) + `"}`
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json callback", "/webhooks/mpesa", fiber.MIMEApplicationJSON, `{"Body":{}}`, fiber.StatusNoContent},
+		{"form callback", "/webhooks/mpesa", fiber.MIMEApplicationForm, "ResultCode=0", fiber.StatusUnsupportedMediaType},
+		{"oversized callback", "/webhooks/mpesa", fiber.MIMEApplicationJSON, large, fiber.StatusRequestEntityTooLarge},
+		{"large body elsewhere", "/payments/process", fiber.MIMEApplicationJSON, large, fiber.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			if resp := testRequest(t, app, req); resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
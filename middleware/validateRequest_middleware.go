@@ -1 +1,136 @@
 package middleware
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields under the name the client sent them with.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "params", "query"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	v.RegisterAlias("tier", "oneof=Starter Pro Enterprise")
+	v.RegisterValidation("msisdn", func(fl validator.FieldLevel) bool {
+		_, ok := utils.NormalizeMSISDN(fl.Field().String())
+		return ok
+	})
+
+	return v
+}
+
+// BindBody parses the JSON request body into dto and validates it.
+func BindBody(c *fiber.Ctx, dto any) error {
+	if err := c.BodyParser(dto); err != nil {
+		return apperrors.Validation("invalid request body")
+	}
+	return Validate(dto)
+}
+
+// BindParams parses the route parameters into dto, using its `params` tags,
+// and validates it.
+func BindParams(c *fiber.Ctx, dto any) error {
+	if err := c.ParamsParser(dto); err != nil {
+		return apperrors.Validation("invalid route parameters")
+	}
+	return Validate(dto)
+}
+
+// BindQuery parses the query string into dto, using its `query` tags, and
+// validates it.
+func BindQuery(c *fiber.Ctx, dto any) error {
+	if err := c.QueryParser(dto); err != nil {
+		return apperrors.Validation("invalid query parameters")
+	}
+	return Validate(dto)
+}
+
+// Validate enforces the `validate` struct tags of dto and returns a
+// validation error listing every offending field.
+func Validate(dto any) error {
+	err := validate.Struct(dto)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	fields := make([]apperrors.FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		fields = append(fields, apperrors.FieldError{
+			Field:   fieldPath(fieldErr),
+			Message: fieldMessage(fieldErr),
+		})
+	}
+	return apperrors.InvalidFields(fields)
+}
+
+// fieldPath drops the DTO type name from the validator namespace, so
+// "LoginRequest.email" is reported as "email".
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return path
+}
+
+func fieldMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_if":
+		return "is required when " + strings.Replace(fieldErr.Param(), " ", " is ", 1)
+	case "uuid":
+		return "must be a valid UUID"
+	case "email":
+		return "must be a valid email address"
+	case "e164":
+		return "must be a phone number in E.164 format, e.g. +254712345678"
+	case "msisdn":
+		return "must be a Kenyan mobile number, e.g. 0712345678 or +254712345678"
+	case "tier":
+		return "must be one of: Starter, Pro, Enterprise"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "gte":
+		return "must be at least " + fieldErr.Param()
+	case "ne":
+		return "must not be " + fieldErr.Param()
+	case "len":
+		return "must be exactly " + fieldErr.Param() + " characters long"
+	case "numeric":
+		return "must contain only digits"
+	case "max":
+		return "must be at most " + fieldErr.Param() + " characters long"
+	case "gtfield":
+		return "must be after " + fieldErr.Param()
+	}
+	return fmt.Sprintf("failed the %q rule", fieldErr.Tag())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/migrations"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate implements the "migrate" command:
+//
+//	migrate up            apply every pending migration
+//	migrate down [steps]  revert the last steps migrations, one by default
+//	migrate status        list migrations and when they were applied
+func runMigrate(ctx context.Context, pool *pgxpool.Pool, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(ctx, pool)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", len(applied))
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid steps %q: %s", args[1], migrateUsage)
+			}
+		}
+		reverted, err := migrations.Down(ctx, pool, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migration(s)\n", len(reverted))
+		return nil
+
+	case "status":
+		statuses, err := migrations.List(ctx, pool)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,255 @@
+// Package migrations embeds the versioned SQL schema migrations and applies
+// them to the database.
+//
+// Migrations live in sql/ as pairs of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Applied versions are
+// recorded in the schema_migrations table, and a Postgres advisory lock makes
+// concurrent runners, e.g. several API instances starting at once, take turns.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey identifies the migration advisory lock. It is an arbitrary
+// constant; every runner must use the same value.
+const lockKey int64 = 7_303_061_018
+
+const createVersionTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration; AppliedAt is nil while it is pending.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.up.sql or .down.sql", fileName)
+		}
+		versionText, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: missing name", fileName)
+		}
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", fileName, err)
+		}
+
+		content, err := files.ReadFile(path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order and returns the ones
+// it applied.
+func Up(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	var applied []Migration
+	err := withLock(ctx, pool, func(conn *pgx.Conn, migrations []Migration, appliedAt map[int64]time.Time) error {
+		for _, migration := range migrations {
+			if _, done := appliedAt[migration.Version]; done {
+				continue
+			}
+			if err := run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the most recently applied steps migrations and returns the
+// ones it reverted, newest first.
+func Down(ctx context.Context, pool *pgxpool.Pool, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withLock(ctx, pool, func(conn *pgx.Conn, migrations []Migration, appliedAt map[int64]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if _, done := appliedAt[migration.Version]; !done {
+				continue
+			}
+			if err := run(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// List reports every embedded migration and when it was applied.
+func List(ctx context.Context, pool *pgxpool.Pool) ([]Status, error) {
+	var statuses []Status
+	err := withLock(ctx, pool, func(_ *pgx.Conn, migrations []Migration, appliedAt map[int64]time.Time) error {
+		for _, migration := range migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if at, done := appliedAt[migration.Version]; done {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock holds the migration advisory lock on a dedicated connection while
+// fn runs, passing it the embedded migrations and the applied versions.
+func withLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgx.Conn, migrations []Migration, appliedAt map[int64]time.Time) error) error {
+	migrations, err := Load()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even after ctx is canceled.
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, createVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	appliedAt, err := appliedVersions(ctx, conn.Conn(), migrations)
+	if err != nil {
+		return err
+	}
+	return fn(conn.Conn(), migrations, appliedAt)
+}
+
+func appliedVersions(ctx context.Context, conn *pgx.Conn, migrations []Migration) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := map[int64]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+
+	appliedAt := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		if !known[version] {
+			return nil, fmt.Errorf("database is at migration %d, which this build does not know about", version)
+		}
+		appliedAt[version] = at
+	}
+	return appliedAt, rows.Err()
+}
+
+// run executes one migration script and updates schema_migrations in the
+// same transaction, so a failing script leaves no trace.
+func run(ctx context.Context, conn *pgx.Conn, migration Migration, script string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	start := time.Now()
+
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+		if up {
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			return err
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	slog.Info("applied migration",
+		slog.Int64("migration.version", migration.Version),
+		slog.String("migration.name", migration.Name),
+		slog.String("migration.direction", direction),
+		slog.Int64("event.duration", time.Since(start).Nanoseconds()),
+	)
+	return nil
+}
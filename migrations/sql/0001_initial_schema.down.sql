@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS branches;
+DROP TABLE IF EXISTS businesses;
+DROP TABLE IF EXISTS users;
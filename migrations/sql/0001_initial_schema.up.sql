@@ -0,0 +1,96 @@
+CREATE TABLE users (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name         VARCHAR(255) NOT NULL DEFAULT '',
+    email        VARCHAR(255) UNIQUE,
+    phone_number VARCHAR(20) UNIQUE,
+    password     VARCHAR(255) NOT NULL,
+    role         VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('admin', 'vendor', 'user')),
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at   TIMESTAMPTZ,
+    CHECK (email IS NOT NULL OR phone_number IS NOT NULL)
+);
+
+CREATE TABLE businesses (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    vendor_id   UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX businesses_vendor_id_idx ON businesses (vendor_id);
+
+CREATE TABLE branches (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses (id) ON DELETE CASCADE,
+    country     VARCHAR(100) NOT NULL DEFAULT '',
+    location    VARCHAR(255) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX branches_business_id_idx ON branches (business_id);
+
+CREATE TABLE products (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses (id) ON DELETE CASCADE,
+    name        VARCHAR(255) NOT NULL,
+    details     TEXT NOT NULL DEFAULT '',
+    quantity    INTEGER NOT NULL CHECK (quantity >= 0),
+    price       NUMERIC(12, 2) NOT NULL CHECK (price > 0),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX products_business_id_idx ON products (business_id);
+
+CREATE TABLE subscriptions (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    business_id UUID NOT NULL REFERENCES businesses (id) ON DELETE CASCADE,
+    tier        VARCHAR(20) NOT NULL CHECK (tier IN ('Starter', 'Pro', 'Enterprise')),
+    start_date  DATE NOT NULL,
+    end_date    DATE,
+    status      VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'canceled', 'suspended')),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX subscriptions_business_id_idx ON subscriptions (business_id);
+
+CREATE TABLE payments (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    amount          NUMERIC(12, 2) NOT NULL,
+    date            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    status          VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'partial', 'rejected')),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at      TIMESTAMPTZ
+);
+
+CREATE INDEX payments_subscription_id_idx ON payments (subscription_id);
+
+CREATE TABLE invoices (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    payment_id UUID NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+    issue_date DATE NOT NULL,
+    due_date   DATE NOT NULL,
+    status     VARCHAR(20) NOT NULL CHECK (status IN ('issued', 'paid', 'overdue', 'canceled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX invoices_payment_id_idx ON invoices (payment_id);
+
+CREATE TABLE notifications (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    invoice_id UUID REFERENCES invoices (id) ON DELETE SET NULL,
+    type       VARCHAR(20) NOT NULL,
+    message    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id);
@@ -0,0 +1,28 @@
+-- Refresh tokens rotate on every use. All tokens descending from one login
+-- share a family_id so the whole chain can be revoked when reuse is detected.
+CREATE TABLE refresh_tokens (
+    id                UUID PRIMARY KEY,
+    family_id         UUID NOT NULL,
+    user_id           UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash        BYTEA NOT NULL UNIQUE,
+    access_token_id   UUID NOT NULL,
+    access_expires_at TIMESTAMPTZ NOT NULL,
+    expires_at        TIMESTAMPTZ NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at           TIMESTAMPTZ,
+    revoked_at        TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+CREATE INDEX refresh_tokens_access_token_id_idx ON refresh_tokens (access_token_id);
+
+-- Access tokens (by jti) revoked before they expire. Rows can be purged once
+-- expires_at has passed since the token is rejected as expired anyway.
+CREATE TABLE revoked_tokens (
+    jti        UUID PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
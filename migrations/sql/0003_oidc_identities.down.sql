@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
+
+-- Passwordless accounts get an unusable hash so the constraint can return;
+-- they can no longer sign in until their password is reset.
+UPDATE users SET password = '!' WHERE password IS NULL;
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
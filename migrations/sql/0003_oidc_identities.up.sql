@@ -0,0 +1,30 @@
+-- Accounts created through an identity provider have no password.
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+
+-- External identities linked to a user. subject is the provider's stable
+-- "sub" claim; email is the address it reported when the link was made.
+CREATE TABLE user_identities (
+    provider   TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- Pending authorization-code logins, keyed by the OAuth state parameter.
+-- Rows are single-use and short-lived.
+CREATE TABLE oidc_login_states (
+    state         TEXT PRIMARY KEY,
+    provider      TEXT NOT NULL,
+    nonce         TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    role          VARCHAR(20) NOT NULL,
+    cookie        BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX oidc_login_states_expires_at_idx ON oidc_login_states (expires_at);
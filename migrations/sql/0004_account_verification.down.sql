@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS verification_codes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS verified,
+    DROP COLUMN IF EXISTS phone_verified_at,
+    DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,27 @@
+-- An account is verified once it has proven ownership of its email address
+-- or phone number. Changing either clears the matching timestamp.
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMPTZ,
+    ADD COLUMN phone_verified_at TIMESTAMPTZ,
+    ADD COLUMN verified BOOLEAN GENERATED ALWAYS AS (email_verified_at IS NOT NULL OR phone_verified_at IS NOT NULL) STORED;
+
+-- Accounts that existed before verification was introduced keep working.
+UPDATE users SET email_verified_at = created_at WHERE email IS NOT NULL;
+UPDATE users SET phone_verified_at = created_at WHERE phone_number IS NOT NULL;
+
+-- One-time codes sent to prove ownership of an email address or phone
+-- number. Only an HMAC of the code is stored. Rows are kept after use so the
+-- send history can be used for resend throttling.
+CREATE TABLE verification_codes (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    channel     VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'phone')),
+    destination VARCHAR(255) NOT NULL,
+    code_hash   BYTEA NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX verification_codes_user_channel_idx ON verification_codes (user_id, channel, created_at DESC);
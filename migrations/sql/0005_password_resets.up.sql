@@ -0,0 +1,13 @@
+-- Single-use password reset tokens. Only a SHA-256 digest of the token is
+-- stored, like refresh tokens.
+CREATE TABLE password_reset_tokens (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash  BYTEA NOT NULL UNIQUE,
+    channel     VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'phone')),
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id, created_at DESC);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS login_attempts;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS failed_login_count;
@@ -0,0 +1,32 @@
+-- Consecutive failed sign-ins since the last success. Reaching the lockout
+-- threshold sets locked_until, with a longer lock for every further failure.
+ALTER TABLE users
+    ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Audit trail of password sign-ins. user_id is NULL when the identifier did
+-- not match an account. Failures per IP are counted from this table too.
+CREATE TABLE login_attempts (
+    id         UUID PRIMARY KEY,
+    user_id    UUID REFERENCES users (id) ON DELETE SET NULL,
+    identifier VARCHAR(255) NOT NULL,
+    ip         VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    outcome    VARCHAR(20) NOT NULL CHECK (outcome IN ('success', 'invalid_credentials', 'locked', 'ip_blocked')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX login_attempts_user_id_idx ON login_attempts (user_id, created_at DESC);
+CREATE INDEX login_attempts_ip_idx ON login_attempts (ip, created_at DESC);
+
+-- Devices a user has signed in from, identified by a digest of the user
+-- agent, so sign-ins from unknown devices can be reported.
+CREATE TABLE user_devices (
+    user_id       UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint   BYTEA NOT NULL,
+    user_agent    VARCHAR(512) NOT NULL DEFAULT '',
+    last_ip       VARCHAR(45) NOT NULL DEFAULT '',
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, fingerprint)
+);
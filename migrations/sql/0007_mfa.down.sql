@@ -0,0 +1,10 @@
+DELETE FROM login_attempts WHERE outcome IN ('mfa_required', 'mfa_failed');
+ALTER TABLE login_attempts DROP CONSTRAINT login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'invalid_credentials', 'locked', 'ip_blocked'));
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS mfa;
+
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
@@ -0,0 +1,44 @@
+-- TOTP enrollment per user. The secret is encrypted by the API; enabled_at
+-- is NULL while enrollment awaits its first code. last_used_step stops a
+-- code from being replayed within its validity window.
+CREATE TABLE user_mfa (
+    user_id        UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         BYTEA NOT NULL,
+    enabled_at     TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Single-use recovery codes, stored as keyed digests.
+CREATE TABLE mfa_recovery_codes (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  BYTEA NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX mfa_recovery_codes_user_id_idx ON mfa_recovery_codes (user_id);
+
+-- Second login step: issued after the first factor succeeds and exchanged
+-- for tokens together with a TOTP or recovery code.
+CREATE TABLE mfa_challenges (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash  BYTEA NOT NULL UNIQUE,
+    identifier  VARCHAR(255) NOT NULL,
+    attempts    INTEGER NOT NULL DEFAULT 0,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX mfa_challenges_expires_at_idx ON mfa_challenges (expires_at);
+
+-- Sessions remember whether they were established with a second factor so
+-- refreshed access tokens keep the same assurance.
+ALTER TABLE refresh_tokens ADD COLUMN mfa BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE login_attempts DROP CONSTRAINT login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'invalid_credentials', 'locked', 'ip_blocked', 'mfa_required', 'mfa_failed'));
@@ -7,12 +7,14 @@ import (
 )
 
 type Claims struct {
-	ID        uuid.UUID  `json:"id"`
-	UserID    uuid.UUID  `json:"user_id"`
-	Email     string     `json:"email"`
-	IssuedAt  time.Time  `json:"issued_at"`
-	ExpiresAt time.Time  `json:"expires_at"`
-	Role      string     `json:"role"`
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Role      string    `json:"role"`
+	// MFA is set when the session was established with a second factor.
+	MFA       bool       `json:"mfa,omitempty"`
 	Status    string     `json:"status"`
 	DeletedAt *time.Time `json:"deleted_at"`
 }
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Request DTOs bound by the controllers through middleware.BindBody,
+// BindParams and BindQuery. Route parameters are kept as strings so the
+// `uuid` rule can report malformed IDs as field errors.
+
+type RegisterByEmailRequest struct {
+	Name     string `json:"name" validate:"max=255"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Role     string `json:"role" validate:"omitempty,oneof=admin vendor user"`
+}
+
+type RegisterByPhoneRequest struct {
+	Name        string `json:"name" validate:"max=255"`
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+	Password    string `json:"password" validate:"required"`
+	Role        string `json:"role" validate:"omitempty,oneof=admin vendor user"`
+}
+
+// Cookie asks for a browser session: the token is set as an HttpOnly cookie
+// instead of being returned in the body. Identifier is an email address or
+// a phone number.
+type LoginRequest struct {
+	Identifier string `json:"identifier" validate:"required,max=255"`
+	Password   string `json:"password" validate:"required"`
+	Cookie     bool   `json:"cookie"`
+}
+
+type LoginByEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Cookie   bool   `json:"cookie"`
+}
+
+type LoginByPhoneRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+	Password    string `json:"password" validate:"required"`
+	Cookie      bool   `json:"cookie"`
+}
+
+// RefreshRequest and LogoutRequest may omit the refresh token when it is
+// sent in the refresh cookie instead.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// VerifyMFARequest takes a TOTP code or a recovery code. Cookie has the same
+// meaning as on the login requests.
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+	Cookie   bool   `json:"cookie"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type ForgotPasswordByEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordByPhoneRequest struct {
+	PhoneNumber string `json:"phone_number" validate:"required,e164"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type SendVerificationRequest struct {
+	Channel string `json:"channel" validate:"required,oneof=email phone"`
+}
+
+type VerifyRequest struct {
+	Channel string `json:"channel" validate:"required,oneof=email phone"`
+	Code    string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type OIDCProviderParams struct {
+	Provider string `params:"provider" validate:"required"`
+}
+
+// OIDCLoginQuery starts an identity provider login. Role is used only when
+// the login creates a new account.
+type OIDCLoginQuery struct {
+	Role   string `query:"role" validate:"omitempty,oneof=admin vendor user"`
+	Cookie bool   `query:"cookie"`
+}
+
+// OIDCCallbackQuery is the provider's redirect back: either a code or an
+// error, together with the state of the login.
+type OIDCCallbackQuery struct {
+	State            string `query:"state" validate:"required"`
+	Code             string `query:"code"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+}
+
+// UpdateProfileRequest changes only the fields that are present. A new email
+// address or phone number has to be verified again.
+type UpdateProfileRequest struct {
+	Name        *string `json:"name" validate:"omitempty,max=255"`
+	Email       *string `json:"email" validate:"omitempty,email"`
+	PhoneNumber *string `json:"phone_number" validate:"omitempty,e164"`
+}
+
+// CloseAccountRequest confirms deactivation or deletion. Password is
+// required for accounts that have one.
+type CloseAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type BusinessIDParams struct {
+	BusinessID string `params:"business_id" validate:"required,uuid"`
+}
+
+type VendorIDParams struct {
+	VendorID string `params:"vendor_id" validate:"required,uuid"`
+}
+
+type CreateBusinessRequest struct {
+	Name        string    `json:"name" validate:"required,max=255"`
+	Description string    `json:"description" validate:"max=2000"`
+	VendorID    uuid.UUID `json:"vendor_id"`
+}
+
+type UpdateBusinessRequest struct {
+	ID          uuid.UUID `json:"id" validate:"required"`
+	Name        string    `json:"name" validate:"required,max=255"`
+	Description string    `json:"description" validate:"max=2000"`
+}
+
+type AddBranchRequest struct {
+	BusinessID uuid.UUID `json:"business_id" validate:"required"`
+	Country    string    `json:"country" validate:"max=100"`
+	Location   string    `json:"location" validate:"required,max=255"`
+}
+
+type UpdateBranchRequest struct {
+	ID         uuid.UUID `json:"id" validate:"required"`
+	BusinessID uuid.UUID `json:"business_id" validate:"required"`
+	Country    string    `json:"country" validate:"max=100"`
+	Location   string    `json:"location" validate:"required,max=255"`
+}
+
+type BranchQuery struct {
+	BusinessID string `query:"business_id" validate:"required,uuid"`
+}
+
+type DeleteBranchQuery struct {
+	BranchID   string `query:"branch_id" validate:"required,uuid"`
+	BusinessID string `query:"business_id" validate:"required,uuid"`
+}
+
+type UpdateBranchesForSubscriptionRequest struct {
+	SubscriptionID uuid.UUID `json:"subscription_id" validate:"required"`
+	BranchChange   int       `json:"branch_change" validate:"ne=0"`
+	BranchNames    []string  `json:"branch_names" validate:"dive,required"`
+}
+
+type ProductParams struct {
+	BusinessID string `params:"business_id" validate:"required,uuid"`
+	ProductID  string `params:"product_id" validate:"required,uuid"`
+}
+
+type ProductRequest struct {
+	Name     string  `json:"name" validate:"required,max=255"`
+	Details  string  `json:"details"`
+	Quantity int     `json:"quantity" validate:"gte=0"`
+	Price    float64 `json:"price" validate:"gt=0"`
+}
+
+type SubscriptionIDParams struct {
+	SubscriptionID string `params:"subscription_id" validate:"required,uuid"`
+}
+
+type CreateSubscriptionRequest struct {
+	BusinessID uuid.UUID  `json:"business_id" validate:"required"`
+	Tier       string     `json:"tier" validate:"required,tier"`
+	EndDate    *time.Time `json:"end_date"`
+}
+
+type UpdateSubscriptionRequest struct {
+	Tier      string     `json:"tier" validate:"required,tier"`
+	StartDate time.Time  `json:"start_date" validate:"required"`
+	EndDate   *time.Time `json:"end_date" validate:"omitempty,gtfield=StartDate"`
+	Status    string     `json:"status" validate:"required,oneof=active canceled suspended"`
+}
+
+type ChangeTierRequest struct {
+	NewTier string `json:"new_tier" validate:"required,tier"`
+}
+
+type PaymentIDParams struct {
+	PaymentID string `params:"payment_id" validate:"required,uuid"`
+}
+
+type AddPaymentRequest struct {
+	SubscriptionID uuid.UUID `json:"subscription_id" validate:"required"`
+	Amount         float64   `json:"amount" validate:"gt=0"`
+	Date           time.Time `json:"date"`
+}
+
+type UpdatePaymentRequest struct {
+	Amount float64   `json:"amount" validate:"gt=0"`
+	Date   time.Time `json:"date" validate:"required"`
+	Status string    `json:"status" validate:"required,oneof=completed partial rejected"`
+}
+
+type ProcessPaymentRequest struct {
+	SubscriptionID uuid.UUID `json:"subscription_id" validate:"required"`
+	Amount         float64   `json:"amount" validate:"required,gt=0"`
+	PaymentMethod  string    `json:"payment_method" validate:"required,oneof=credit_card mpesa"`
+	// PhoneNumber is the M-Pesa account the STK push is sent to.
+	PhoneNumber string `json:"phone_number,omitempty" validate:"required_if=PaymentMethod mpesa,omitempty,msisdn"`
+	Description string `json:"description,omitempty" validate:"max=255"`
+}
+
+type InvoiceIDParams struct {
+	InvoiceID string `params:"invoice_id" validate:"required,uuid"`
+}
+
+type GenerateInvoiceParams struct {
+	PaymentID string `params:"payment_id" validate:"required,uuid"`
+	UserID    string `params:"user_id" validate:"required,uuid"`
+}
+
+type AddInvoiceRequest struct {
+	PaymentID uuid.UUID `json:"payment_id" validate:"required"`
+	IssueDate time.Time `json:"issue_date" validate:"required"`
+	DueDate   time.Time `json:"due_date" validate:"required,gtfield=IssueDate"`
+	Status    string    `json:"status" validate:"required,oneof=issued paid overdue canceled"`
+}
+
+type UpdateInvoiceRequest struct {
+	ID        uuid.UUID `json:"id" validate:"required"`
+	PaymentID uuid.UUID `json:"payment_id" validate:"required"`
+	IssueDate time.Time `json:"issue_date" validate:"required"`
+	DueDate   time.Time `json:"due_date" validate:"required,gtfield=IssueDate"`
+	Status    string    `json:"status" validate:"required,oneof=issued paid overdue canceled"`
+}
+
+type NotificationIDParams struct {
+	NotificationID string `params:"notification_id" validate:"required,uuid"`
+}
+
+type UserIDParams struct {
+	UserID string `params:"user_id" validate:"required,uuid"`
+}
+
+type CreateNotificationRequest struct {
+	UserID    uuid.UUID  `json:"user_id" validate:"required"`
+	InvoiceID *uuid.UUID `json:"invoice_id"`
+	Type      string     `json:"type" validate:"required,max=20"`
+	Message   string     `json:"message" validate:"required"`
+}
+
+type UpdateNotificationRequest struct {
+	ID      uuid.UUID `json:"id" validate:"required"`
+	Type    string    `json:"type" validate:"required,max=20"`
+	Message string    `json:"message" validate:"required"`
+}
+
+// MpesaCallbackRequest is the result notification Daraja posts when an STK
+// push completes.
+type MpesaCallbackRequest struct {
+	Body struct {
+		STKCallback struct {
+			MerchantRequestID string `json:"MerchantRequestID"`
+			CheckoutRequestID string `json:"CheckoutRequestID" validate:"required,max=255"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// Roles a user can hold. Admins manage the whole platform, vendors own
+// businesses and pay for listings, and end users browse the directory.
+const (
+	RoleAdmin  = "admin"
+	RoleVendor = "vendor"
+	RoleUser   = "user"
+)
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleVendor, RoleUser:
+		return true
+	}
+	return false
+}
+
+// IsSelfAssignableRole reports whether a user may pick role for themselves
+// when registering. Privileged roles have to be granted by an admin.
+func IsSelfAssignableRole(role string) bool {
+	return role == RoleVendor || role == RoleUser
+}
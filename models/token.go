@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// TokenPair is issued on sign-in and on every refresh. The refresh token is
+// single-use: exchanging it returns a new pair.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// MFAChallenge is returned instead of tokens when the first factor succeeded
+// but the account requires a second one. The token is exchanged together
+// with a TOTP or recovery code at /auth/mfa/verify.
+type MFAChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	Token       string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// LoginResult holds the tokens of a completed sign-in, or the challenge of
+// one that still needs a second factor.
+type LoginResult struct {
+	Tokens    *TokenPair
+	Challenge *MFAChallenge
+}
+
+// MFAEnrollment is the TOTP secret of a pending enrollment. ProvisioningURI
+// is the otpauth:// URI authenticator apps scan as a QR code.
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
@@ -14,3 +14,17 @@ type User struct {
 	Role        string     `json:"role"`
 	DeletedAt   *time.Time `json:"deleted_at"`
 }
+
+// Profile is the signed-in user's view of their own account.
+type Profile struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	Email         *string   `json:"email"`
+	PhoneNumber   *string   `json:"phone_number"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
+	Verified      bool      `json:"verified"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
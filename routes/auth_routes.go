@@ -2,19 +2,38 @@ package routes
 
 import (
 	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func SetupAuthRoutes(app *fiber.App, db *pgxpool.Pool) {
+func SetupAuthRoutes(app *fiber.App, db *pgxpool.Pool, oidcProviders services.OIDCProviders, sms utils.SMSSender, mail utils.EmailSender) {
 
-	authController := controllers.AuthController{DB: db}
+	authController := controllers.AuthController{DB: db, OIDC: oidcProviders, SMS: sms, Email: mail}
 
 	authGroup := app.Group("/auth")
 
 	authGroup.Post("/register/email", authController.RegisterByMail)
 	authGroup.Post("/register/phone", authController.RegisterByPhoneNumber)
+	authGroup.Post("/login", authController.Login)
 	authGroup.Post("/login/email", authController.LoginByMail)
 	authGroup.Post("/login/phone", authController.LoginByPhoneNumber)
+	authGroup.Post("/refresh", authController.Refresh)
+	authGroup.Post("/logout", middleware.AuthenticatePendingMFA(db), authController.Logout)
+	authGroup.Post("/mfa/verify", authController.VerifyMFA)
+	authGroup.Post("/mfa/enroll", middleware.AuthenticatePendingMFA(db), authController.EnrollMFA)
+	authGroup.Post("/mfa/enroll/confirm", middleware.AuthenticatePendingMFA(db), authController.ConfirmMFA)
+	authGroup.Post("/mfa/recovery-codes", middleware.Authenticate(db), authController.RegenerateRecoveryCodes)
+	authGroup.Post("/mfa/disable", middleware.Authenticate(db), authController.DisableMFA)
+	authGroup.Post("/password/forgot/email", authController.ForgotPasswordByMail)
+	authGroup.Post("/password/forgot/phone", authController.ForgotPasswordByPhoneNumber)
+	authGroup.Post("/password/reset", authController.ResetPassword)
+	authGroup.Post("/password/change", middleware.Authenticate(db), authController.ChangePassword)
+	authGroup.Post("/verify/send", middleware.Authenticate(db), authController.SendVerificationCode)
+	authGroup.Post("/verify", middleware.Authenticate(db), authController.Verify)
+	authGroup.Get("/oidc/:provider/login", authController.OIDCLogin)
+	authGroup.Get("/oidc/:provider/callback", authController.OIDCCallback)
 	authGroup.Get("/validate", authController.ValidateToken)
 }
@@ -2,6 +2,9 @@ package routes
 
 import (
 	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -10,11 +13,19 @@ func SetupBranchRoutes(app *fiber.App, db *pgxpool.Pool) {
 
 	branchController := controllers.BranchController{DB: db}
 
+	authenticated := middleware.Authenticate(db)
+	vendorOnly := middleware.RequireRole(models.RoleVendor, models.RoleAdmin)
+
+	addBranchBusiness := middleware.BodyID(func(r *models.AddBranchRequest) string { return r.BusinessID.String() })
+	updateBranchBusiness := middleware.BodyID(func(r *models.UpdateBranchRequest) string { return r.BusinessID.String() })
+	deleteBranchBusiness := middleware.QueryID(func(r *models.DeleteBranchQuery) string { return r.BusinessID })
+	branchesSubscription := middleware.BodyID(func(r *models.UpdateBranchesForSubscriptionRequest) string { return r.SubscriptionID.String() })
+
 	branchGroup := app.Group("/branches")
 
-	branchGroup.Post("/add", branchController.AddBranch)
+	branchGroup.Post("/add", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceBusiness, addBranchBusiness), branchController.AddBranch)
 	branchGroup.Get("/", branchController.GetBranches)
-	branchGroup.Put("/update", branchController.UpdateBranch)
-	branchGroup.Delete("/delete", branchController.DeleteBranch)
-	branchGroup.Put("/update-for-subscription", branchController.UpdateBranchesForSubscription)
+	branchGroup.Put("/update", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceBusiness, updateBranchBusiness), branchController.UpdateBranch)
+	branchGroup.Delete("/delete", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceBusiness, deleteBranchBusiness), branchController.DeleteBranch)
+	branchGroup.Put("/update-for-subscription", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceSubscription, branchesSubscription), branchController.UpdateBranchesForSubscription)
 }
@@ -2,6 +2,9 @@ package routes
 
 import (
 	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -10,12 +13,17 @@ func SetupBusinessRoutes(app *fiber.App, db *pgxpool.Pool) {
 
 	businessController := controllers.BusinessController{DB: db}
 
+	authenticated := middleware.Authenticate(db)
+	vendorOnly := middleware.RequireRole(models.RoleVendor, models.RoleAdmin)
+
+	updatedBusiness := middleware.BodyID(func(r *models.UpdateBusinessRequest) string { return r.ID.String() })
+
 	businessGroup := app.Group("/businesses")
 
 	businessGroup.Get("/", businessController.GetAllBusinesses)
-	businessGroup.Post("/create", businessController.CreateBusiness)
+	businessGroup.Post("/create", authenticated, vendorOnly, middleware.RequireVerified(db), businessController.CreateBusiness)
 	businessGroup.Get("/:business_id", businessController.GetBusinessByID)
-	businessGroup.Put("/update", businessController.UpdateBusiness)
-	businessGroup.Delete("/delete/:business_id", businessController.DeleteBusiness)
+	businessGroup.Put("/update", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceBusiness, updatedBusiness), businessController.UpdateBusiness)
+	businessGroup.Delete("/delete/:business_id", authenticated, vendorOnly, middleware.RequireOwnership(db, services.ResourceBusiness, middleware.ParamID("business_id")), businessController.DeleteBusiness)
 	businessGroup.Get("/vendor/:vendor_id", businessController.GetBusinessesByVendorID)
 }
@@ -2,6 +2,9 @@ package routes
 
 import (
 	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -10,12 +13,14 @@ func SetupInvoiceRoutes(app *fiber.App, db *pgxpool.Pool) {
 
 	invoiceController := controllers.InvoiceController{DB: db}
 
-	invoiceGroup := app.Group("/invoices")
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
 
-	invoiceGroup.Get("/", invoiceController.GetAllInvoices)
-	invoiceGroup.Post("/create", invoiceController.AddInvoice)
-	invoiceGroup.Get("/:invoice_id", invoiceController.GetInvoiceByID)
-	invoiceGroup.Put("/update", invoiceController.UpdateInvoice)
-	invoiceGroup.Delete("/delete/:invoice_id", invoiceController.DeleteInvoice)
-	invoiceGroup.Post("/generate/:payment_id/:user_id", invoiceController.GenerateInvoiceForPayment)
+	invoiceGroup := app.Group("/invoices", middleware.Authenticate(db), middleware.RequireRole(models.RoleVendor, models.RoleAdmin))
+
+	invoiceGroup.Get("/", adminOnly, invoiceController.GetAllInvoices)
+	invoiceGroup.Post("/create", adminOnly, invoiceController.AddInvoice)
+	invoiceGroup.Get("/:invoice_id", middleware.RequireOwnership(db, services.ResourceInvoice, middleware.ParamID("invoice_id")), invoiceController.GetInvoiceByID)
+	invoiceGroup.Put("/update", adminOnly, invoiceController.UpdateInvoice)
+	invoiceGroup.Delete("/delete/:invoice_id", adminOnly, invoiceController.DeleteInvoice)
+	invoiceGroup.Post("/generate/:payment_id/:user_id", middleware.RequireOwnership(db, services.ResourcePayment, middleware.ParamID("payment_id")), invoiceController.GenerateInvoiceForPayment)
 }
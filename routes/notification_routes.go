@@ -2,19 +2,28 @@ package routes
 
 import (
 	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func SetupNotificationRoutes(app *fiber.App, db *pgxpool.Pool) {
-	notificationController := controllers.NotificationController{Pool: db}
+func SetupNotificationRoutes(app *fiber.App, db *pgxpool.Pool, mail utils.EmailSender) {
+	notificationController := controllers.NotificationController{Pool: db, Email: mail}
 
-	notificationGroup := app.Group("/notifications")
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
 
-	notificationGroup.Post("/", notificationController.CreateNotification)
-	notificationGroup.Get("/:notification_id", notificationController.GetNotificationByID)
-	notificationGroup.Get("/user/:user_id", notificationController.GetNotificationsByUserID)
-	notificationGroup.Put("/", notificationController.UpdateNotification)
-	notificationGroup.Delete("/:notification_id", notificationController.DeleteNotification)
-	notificationGroup.Post("/reminders", notificationController.SendReminderNotifications)
+	ownsNotification := middleware.RequireOwnership(db, services.ResourceNotification, middleware.ParamID("notification_id"))
+
+	notificationGroup := app.Group("/notifications", middleware.Authenticate(db))
+
+	notificationGroup.Get("/", notificationController.GetOwnNotifications)
+	notificationGroup.Post("/", adminOnly, notificationController.CreateNotification)
+	notificationGroup.Get("/user/:user_id", adminOnly, notificationController.GetNotificationsByUserID)
+	notificationGroup.Get("/:notification_id", ownsNotification, notificationController.GetNotificationByID)
+	notificationGroup.Put("/", adminOnly, notificationController.UpdateNotification)
+	notificationGroup.Delete("/:notification_id", ownsNotification, notificationController.DeleteNotification)
+	notificationGroup.Post("/reminders", adminOnly, notificationController.SendReminderNotifications)
 }
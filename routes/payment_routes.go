@@ -1 +1,32 @@
 package routes
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func SetupPaymentRoutes(app *fiber.App, db *pgxpool.Pool, mail utils.EmailSender) {
+
+	paymentController := controllers.PaymentController{DB: db, Email: mail}
+
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
+
+	paidSubscription := middleware.BodyID(func(r *models.ProcessPaymentRequest) string { return r.SubscriptionID.String() })
+
+	paymentGroup := app.Group("/payments", middleware.Authenticate(db), middleware.RequireRole(models.RoleVendor, models.RoleAdmin))
+
+	paymentGroup.Get("/", adminOnly, paymentController.GetAllPayments)
+	paymentGroup.Post("/", adminOnly, paymentController.AddPayment)
+	paymentGroup.Post("/process", middleware.RequireOwnership(db, services.ResourceSubscription, paidSubscription), paymentController.ProcessPayment)
+	paymentGroup.Get("/subscription/:subscription_id", middleware.RequireOwnership(db, services.ResourceSubscription, middleware.ParamID("subscription_id")), paymentController.GetPaymentsBySubscriptionID)
+	paymentGroup.Post("/subscription/:subscription_id/overdue", adminOnly, paymentController.HandleOverduePayment)
+	paymentGroup.Get("/:payment_id", middleware.RequireOwnership(db, services.ResourcePayment, middleware.ParamID("payment_id")), paymentController.GetPaymentByID)
+	paymentGroup.Put("/:payment_id", adminOnly, paymentController.UpdatePayment)
+	paymentGroup.Delete("/:payment_id", adminOnly, paymentController.DeletePayment)
+	paymentGroup.Post("/:payment_id/partial", adminOnly, paymentController.HandlePartialPayment)
+}
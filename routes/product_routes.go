@@ -1 +1,26 @@
 package routes
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func SetupProductRoutes(app *fiber.App, db *pgxpool.Pool) {
+
+	productController := controllers.NewProductController(db)
+
+	authenticated := middleware.Authenticate(db)
+	vendorOnly := middleware.RequireRole(models.RoleVendor, models.RoleAdmin)
+	ownsBusiness := middleware.RequireOwnership(db, services.ResourceBusiness, middleware.ParamID("business_id"))
+
+	productGroup := app.Group("/businesses/:business_id/products")
+
+	productGroup.Get("/", productController.GetProducts)
+	productGroup.Post("/", authenticated, vendorOnly, ownsBusiness, productController.AddProduct)
+	productGroup.Put("/:product_id", authenticated, vendorOnly, ownsBusiness, productController.UpdateProduct)
+	productGroup.Delete("/:product_id", authenticated, vendorOnly, ownsBusiness, productController.DeleteProduct)
+}
@@ -1 +1,32 @@
 package routes
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func SetupSubscriptionRoutes(app *fiber.App, db *pgxpool.Pool) {
+
+	subscriptionController := controllers.NewSubscriptionController(db)
+
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
+	ownsSubscription := middleware.RequireOwnership(db, services.ResourceSubscription, middleware.ParamID("subscription_id"))
+
+	subscribedBusiness := middleware.BodyID(func(r *models.CreateSubscriptionRequest) string { return r.BusinessID.String() })
+
+	subscriptionGroup := app.Group("/subscriptions", middleware.Authenticate(db), middleware.RequireRole(models.RoleVendor, models.RoleAdmin))
+
+	subscriptionGroup.Post("/create", middleware.RequireOwnership(db, services.ResourceBusiness, subscribedBusiness), subscriptionController.CreateSubscription)
+	subscriptionGroup.Get("/:subscription_id", ownsSubscription, subscriptionController.GetSubscription)
+	// Status and dates are billing state; vendors change them through cancel,
+	// upgrade and downgrade.
+	subscriptionGroup.Put("/:subscription_id", adminOnly, subscriptionController.UpdateSubscription)
+	subscriptionGroup.Post("/:subscription_id/cancel", ownsSubscription, subscriptionController.CancelSubscription)
+	subscriptionGroup.Post("/:subscription_id/upgrade", ownsSubscription, subscriptionController.UpgradeSubscription)
+	subscriptionGroup.Post("/:subscription_id/downgrade", ownsSubscription, subscriptionController.DowngradeSubscription)
+	subscriptionGroup.Delete("/:subscription_id", ownsSubscription, subscriptionController.DeleteSubscription)
+}
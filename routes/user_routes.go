@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/Bradkibs/MONOS-challenge/middleware"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func SetupUserRoutes(app *fiber.App, db *pgxpool.Pool, sms utils.SMSSender, mail utils.EmailSender) {
+
+	userController := controllers.UserController{DB: db, SMS: sms, Email: mail}
+
+	userGroup := app.Group("/me", middleware.Authenticate(db))
+
+	userGroup.Get("/", userController.GetProfile)
+	userGroup.Patch("/", userController.UpdateProfile)
+	userGroup.Post("/deactivate", userController.Deactivate)
+	userGroup.Delete("/", userController.Delete)
+
+	// Deactivated users cannot sign in, so erasing their data afterwards is
+	// done by an administrator.
+	adminGroup := app.Group("/users", middleware.Authenticate(db), middleware.RequireRole(models.RoleAdmin))
+	adminGroup.Delete("/:user_id", userController.Erase)
+}
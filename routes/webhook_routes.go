@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/Bradkibs/MONOS-challenge/controllers"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetupWebhookRoutes mounts the payment gateway callbacks. main.go restricts
+// /webhooks to WEBHOOK_ALLOWED_NETWORKS.
+func SetupWebhookRoutes(app *fiber.App) {
+
+	webhookController := controllers.WebhookController{}
+
+	webhookGroup := app.Group("/webhooks")
+
+	webhookGroup.Post("/mpesa", webhookController.MpesaCallback)
+}
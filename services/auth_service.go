@@ -2,8 +2,9 @@ package services
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/golang-jwt/jwt/v4"
@@ -11,13 +12,19 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 	"unicode"
 )
 
-var jwtSecret = os.Getenv("JWT_SECRET")
+// jwtSecret is read on every call because the .env file is loaded after
+// package initialisation.
+func jwtSecret() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
 
 func HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -31,105 +38,162 @@ func CheckPassword(hashedPassword, plainPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
 }
 
-func GenerateJWT(userID, emailOrPhoneNumber, role string, deletedAt *time.Time) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// newAccessToken signs a short-lived access token. Its claims ID is the jti
+// recorded with the refresh token and checked against the revocation list.
+func newAccessToken(userID uuid.UUID, emailOrPhoneNumber, role string, mfa bool) (string, *models.Claims, error) {
+	now := time.Now()
 	claims := &models.Claims{
 		ID:        utils.GenerateUniqueID(),
-		UserID:    uuid.MustParse(userID),
+		UserID:    userID,
 		Email:     emailOrPhoneNumber,
-		IssuedAt:  time.Now(),
-		ExpiresAt: expirationTime,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(AccessTokenTTL),
 		Role:      role,
-		DeletedAt: deletedAt,
+		MFA:       mfa,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecret))
+	signedToken, err := token.SignedString(jwtSecret())
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	return signedToken, claims, nil
+}
+
+// ParseJWT verifies tokenString and rejects it if it has been revoked.
+func ParseJWT(tokenString string, pool *pgxpool.Pool) (*models.Claims, error) {
+	claims, err := DecodeJWT(tokenString)
+	if err != nil {
+		return nil, err
 	}
-	return signedToken, nil
+
+	revoked, err := IsTokenRevoked(claims.ID, pool)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, apperrors.Unauthorized("token has been revoked")
+	}
+	return claims, nil
 }
 
-func ParseJWT(tokenString string) (*models.Claims, error) {
+// DecodeJWT verifies the signature and expiry of tokenString without
+// consulting the revocation list. Use ParseJWT to authenticate requests.
+func DecodeJWT(tokenString string) (*models.Claims, error) {
 	claims := &models.Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(jwtSecret), nil
+		return jwtSecret(), nil
 	})
 
 	if err != nil || !token.Valid {
-		return nil, errors.New("invalid or expired token")
+		return nil, apperrors.Unauthorized("invalid or expired token")
 	}
 	return claims, nil
 }
 
-func RegisterUserByEmail(user *models.User, pool *pgxpool.Pool) (string, error) {
+// registrationRole returns the role a new account is created with. Users
+// default to the end-user role and may only opt into being a vendor.
+func registrationRole(role string) (string, error) {
+	if role == "" {
+		return models.RoleUser, nil
+	}
+	if !models.IsValidRole(role) {
+		return "", apperrors.Validation("invalid role")
+	}
+	if !models.IsSelfAssignableRole(role) {
+		return "", apperrors.Forbidden("role cannot be self-assigned")
+	}
+	return role, nil
+}
+
+func RegisterUserByEmail(user *models.User, mail utils.EmailSender, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	role, err := registrationRole(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = role
+
 	if !isValidEmail(user.Email) {
-		return "", errors.New("invalid email format")
+		return nil, apperrors.Validation("invalid email format")
 	}
 	if !isValidPassword(user.Password) {
-		return "", errors.New("password must be at least 8 characters long and contain a mix of letters, numbers, and special characters")
+		return nil, apperrors.Validation(passwordRules)
 	}
 
 	var existingUserID uuid.UUID
-	err := pool.QueryRow(context.Background(), "SELECT id FROM users WHERE email = $1", user.Email).Scan(&existingUserID)
+	err = pool.QueryRow(context.Background(), "SELECT id FROM users WHERE email = $1", user.Email).Scan(&existingUserID)
 	if err == nil {
-		return "", errors.New("user with this email already exists")
+		return nil, apperrors.Conflict("user with this email already exists")
 	} else if err != pgx.ErrNoRows {
-		return "", fmt.Errorf("failed to check for existing user: %v", err)
+		return nil, fmt.Errorf("failed to check for existing user: %v", err)
 	}
 
 	hashedPassword, err := HashPassword(user.Password)
 	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %v", err)
+		return nil, fmt.Errorf("failed to hash password: %v", err)
 	}
 
 	userID := utils.GenerateUniqueID()
-	err = pool.QueryRow(context.Background(), "INSERT INTO users (email, password, role) VALUES ($1, $2, $3)", user.Email, hashedPassword, user.Role).Scan(&userID)
+	_, err = pool.Exec(context.Background(), "INSERT INTO users (id, name, email, password, role) VALUES ($1, $2, $3, $4, $5)", userID, user.Name, user.Email, hashedPassword, user.Role)
 	if err != nil {
-		return "", fmt.Errorf("failed to create user: %v", err)
+		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
-	token, err := GenerateJWT(userID.String(), user.Email, user.Role, nil)
+	tokens, err := IssueTokens(userID, user.Email, user.Role, pool)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	// The account is usable right away; the code can be resent if this fails.
+	if err := SendVerificationCode(userID, VerificationEmail, nil, mail, pool); err != nil {
+		slog.Warn("failed to send verification code", slog.String("user.id", userID.String()), logging.Err(err))
 	}
-	return token, nil
+	return tokens, nil
 }
-func RegisterUserByPhoneNumber(phoneNumber, password, role string, pool *pgxpool.Pool) (string, error) {
+func RegisterUserByPhoneNumber(name, phoneNumber, password, role string, sms utils.SMSSender, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	role, err := registrationRole(role)
+	if err != nil {
+		return nil, err
+	}
+
 	if !isValidPhoneNumber(phoneNumber) {
-		return "", errors.New("invalid Phone number format")
+		return nil, apperrors.Validation("invalid Phone number format")
 	}
 	if !isValidPassword(password) {
-		return "", errors.New("password must be at least 8 characters long and contain a mix of letters, numbers, and special characters")
+		return nil, apperrors.Validation(passwordRules)
 	}
 
 	var existingUserID uuid.UUID
-	err := pool.QueryRow(context.Background(), "SELECT id FROM users WHERE phone_number = $1 AND deleted_at IS NULL", phoneNumber).Scan(&existingUserID)
+	err = pool.QueryRow(context.Background(), "SELECT id FROM users WHERE phone_number = $1", phoneNumber).Scan(&existingUserID)
 	if err == nil {
-		return "", errors.New("user with this email already exists")
+		return nil, apperrors.Conflict("user with this phone number already exists")
 	} else if err != pgx.ErrNoRows {
-		return "", fmt.Errorf("failed to check for existing user: %v", err)
+		return nil, fmt.Errorf("failed to check for existing user: %v", err)
 	}
 
 	hashedPassword, err := HashPassword(password)
 	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %v", err)
+		return nil, fmt.Errorf("failed to hash password: %v", err)
 	}
 
 	userID := utils.GenerateUniqueID()
-	err = pool.QueryRow(context.Background(), "INSERT INTO users (phone_number, password, role) VALUES ($1, $2, $3) RETURNING id AND deleted_at IS NULL", phoneNumber, hashedPassword, role).Scan(&userID)
+	_, err = pool.Exec(context.Background(), "INSERT INTO users (id, name, phone_number, password, role) VALUES ($1, $2, $3, $4, $5)", userID, name, phoneNumber, hashedPassword, role)
 	if err != nil {
-		return "", fmt.Errorf("failed to create user: %v", err)
+		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
-	token, err := GenerateJWT(userID.String(), phoneNumber, role, nil)
+	tokens, err := IssueTokens(userID, phoneNumber, role, pool)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	// The account is usable right away; the code can be resent if this fails.
+	if err := SendVerificationCode(userID, VerificationPhone, sms, nil, pool); err != nil {
+		slog.Warn("failed to send verification code", slog.String("user.id", userID.String()), logging.Err(err))
 	}
-	return token, nil
+	return tokens, nil
 }
 
 func isValidPhoneNumber(phone string) bool {
@@ -142,6 +206,8 @@ func isValidEmail(email string) bool {
 	return re.MatchString(email)
 }
 
+const passwordRules = "password must be at least 8 characters long and contain a mix of letters, numbers, and special characters"
+
 func isValidPassword(password string) bool {
 	if len(password) < 8 {
 		return false
@@ -160,26 +226,86 @@ func isValidPassword(password string) bool {
 	return hasNumber && hasSpecial && hasLetter
 }
 
-func LoginUser(email, password string, pool *pgxpool.Pool) (string, error) {
+// LoginUser signs a user in with a password. identifier is either the
+// account's email address or its phone number. Failed attempts count towards
+// both a lockout of the account and a block of the client IP, and every
+// attempt is written to the login audit table. Accounts with two-factor
+// authentication get an MFA challenge instead of tokens.
+func LoginUser(identifier, password string, client LoginClient, mail utils.EmailSender, pool *pgxpool.Pool) (*models.LoginResult, error) {
+	ctx := context.Background()
+
+	blocked, err := ipLoginBlocked(ctx, pool, client.IP)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		recordLoginAttempt(ctx, pool, nil, identifier, client, LoginIPBlocked)
+		return nil, apperrors.TooManyRequests("too many failed sign-ins from this address, please try again later")
+	}
+
+	query := "SELECT id, email, phone_number, password, role, locked_until FROM users WHERE email = $1 AND deleted_at IS NULL"
+	if !strings.Contains(identifier, "@") {
+		query = "SELECT id, email, phone_number, password, role, locked_until FROM users WHERE phone_number = $1 AND deleted_at IS NULL"
+	}
+
 	var userID uuid.UUID
-	var hashedPassword, role string
-	var deletedAt *time.Time
-	err := pool.QueryRow(context.Background(), "SELECT id, password, role, deleted_at FROM users WHERE email = $1 AND deleted_at IS NULL", email).Scan(&userID, &hashedPassword, &role, &deletedAt)
+	var email, phoneNumber, hashedPassword *string
+	var role string
+	var lockedUntil *time.Time
+	err = pool.QueryRow(ctx, query, identifier).Scan(&userID, &email, &phoneNumber, &hashedPassword, &role, &lockedUntil)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		if err != pgx.ErrNoRows {
+			return nil, err
+		}
+		recordLoginAttempt(ctx, pool, nil, identifier, client, LoginInvalidCredentials)
+		return nil, apperrors.Unauthorized("invalid credentials")
 	}
 
-	if deletedAt != nil {
-		return "", errors.New("account is deactivated")
+	// A locked account is refused without looking at the password.
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginLocked)
+		return nil, lockedError(*lockedUntil)
 	}
 
-	if err := CheckPassword(hashedPassword, password); err != nil {
-		return "", errors.New("invalid email or password")
+	// Accounts created through an identity provider have no password.
+	if hashedPassword == nil || CheckPassword(*hashedPassword, password) != nil {
+		recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginInvalidCredentials)
+		lockedUntil, err := registerFailedLogin(ctx, pool, userID)
+		if err != nil {
+			return nil, err
+		}
+		if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+			return nil, lockedError(*lockedUntil)
+		}
+		return nil, apperrors.Unauthorized("invalid credentials")
 	}
 
-	token, err := GenerateJWT(userID.String(), email, role, deletedAt)
+	required, err := mfaRequired(ctx, pool, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, err
 	}
-	return token, nil
+	// With two factors the failure count is only cleared once the second one
+	// passes, so wrong codes keep adding up across challenges.
+	if required {
+		challenge, err := newMFAChallenge(ctx, pool, userID, identifier)
+		if err != nil {
+			return nil, err
+		}
+		recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginMFARequired)
+		return &models.LoginResult{Challenge: challenge}, nil
+	}
+
+	if err := clearFailedLogins(ctx, pool, userID); err != nil {
+		return nil, err
+	}
+	recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginSuccess)
+
+	tokens, err := IssueTokens(userID, tokenSubject(email, phoneNumber), role, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	// Sending the alert must not hold up the sign-in.
+	runInBackground(func() { rememberDevice(context.Background(), pool, userID, email, client, mail) })
+	return &models.LoginResult{Tokens: tokens}, nil
 }
@@ -2,15 +2,15 @@ package services
 
 import (
 	"context"
-	"errors"
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func AddBranch(branch *models.Branch, pool *pgxpool.Pool) error {
-	query := `INSERT INTO branches (id, business_id, location) VALUES ($1, $2, $3)`
-	_, err := pool.Exec(context.Background(), query, branch.ID, branch.BusinessID, branch.Location)
+	query := `INSERT INTO branches (id, business_id, country, location) VALUES ($1, $2, $3, $4)`
+	_, err := pool.Exec(context.Background(), query, branch.ID, branch.BusinessID, branch.Country, branch.Location)
 	if err != nil {
 		return err
 	}
@@ -18,7 +18,7 @@ func AddBranch(branch *models.Branch, pool *pgxpool.Pool) error {
 }
 
 func GetBranchesByBusinessID(businessID string, pool *pgxpool.Pool) ([]models.Branch, error) {
-	query := `SELECT id, business_id, location FROM branches WHERE business_id = $1`
+	query := `SELECT id, business_id, country, location FROM branches WHERE business_id = $1 AND deleted_at IS NULL`
 	rows, err := pool.Query(context.Background(), query, businessID)
 	if err != nil {
 		return nil, err
@@ -28,7 +28,7 @@ func GetBranchesByBusinessID(businessID string, pool *pgxpool.Pool) ([]models.Br
 	var branches []models.Branch
 	for rows.Next() {
 		var branch models.Branch
-		if err := rows.Scan(&branch.ID, &branch.BusinessID, &branch.Location); err != nil {
+		if err := rows.Scan(&branch.ID, &branch.BusinessID, &branch.Country, &branch.Location); err != nil {
 			return nil, err
 		}
 		branches = append(branches, branch)
@@ -38,14 +38,14 @@ func GetBranchesByBusinessID(businessID string, pool *pgxpool.Pool) ([]models.Br
 }
 
 func UpdateBranch(branch *models.Branch, pool *pgxpool.Pool) error {
-	query := `UPDATE branches SET location = $2 WHERE id = $1 AND business_id = $3`
-	cmdTag, err := pool.Exec(context.Background(), query, branch.ID, branch.Location, branch.BusinessID)
+	query := `UPDATE branches SET country = $2, location = $3 WHERE id = $1 AND business_id = $4`
+	cmdTag, err := pool.Exec(context.Background(), query, branch.ID, branch.Country, branch.Location, branch.BusinessID)
 	if err != nil {
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were updated, branch not found")
+		return apperrors.NotFound("no rows were updated, branch not found")
 	}
 
 	return nil
@@ -59,7 +59,7 @@ func DeleteBranch(branchID string, businessID string, pool *pgxpool.Pool) error
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were deleted, branch not found")
+		return apperrors.NotFound("no rows were deleted, branch not found")
 	}
 
 	return nil
@@ -68,15 +68,15 @@ func DeleteBranch(branchID string, businessID string, pool *pgxpool.Pool) error
 func UpdateBranchesForSubscription(subscriptionID string, branchChange int, branchNames []string, pool *pgxpool.Pool) error {
 	// Fetch the business ID for the subscription
 	var businessID string
-	businessQuery := `SELECT businessId FROM subscriptions WHERE id = $1`
+	businessQuery := `SELECT business_id FROM subscriptions WHERE id = $1`
 	err := pool.QueryRow(context.Background(), businessQuery, subscriptionID).Scan(&businessID)
 	if err != nil {
-		return errors.New("subscription not found or invalid")
+		return notFoundOr(err, "subscription not found or invalid")
 	}
 
 	// Fetch the current branch count for the business
 	var branchCount int
-	countQuery := `SELECT COUNT(*) FROM branches WHERE businessId = $1`
+	countQuery := `SELECT COUNT(*) FROM branches WHERE business_id = $1 AND deleted_at IS NULL`
 	err = pool.QueryRow(context.Background(), countQuery, businessID).Scan(&branchCount)
 	if err != nil {
 		return err
@@ -85,18 +85,18 @@ func UpdateBranchesForSubscription(subscriptionID string, branchChange int, bran
 	// Calculate the new branch count
 	newBranchCount := branchCount + branchChange
 	if newBranchCount < 1 {
-		return errors.New("cannot remove more branches than currently exist")
+		return apperrors.Validation("cannot remove more branches than currently exist")
 	}
 
 	// Adding branches
 	if branchChange > 0 {
 		if len(branchNames) < branchChange {
-			return errors.New("not enough branch names provided for the number of branches to add")
+			return apperrors.Validation("not enough branch names provided for the number of branches to add")
 		}
 
 		for _, branchName := range branchNames[:branchChange] {
 			newBranchID := uuid.New()
-			insertQuery := `INSERT INTO branches (id, businessId, location) VALUES ($1, $2, $3)`
+			insertQuery := `INSERT INTO branches (id, business_id, location) VALUES ($1, $2, $3)`
 			_, err := pool.Exec(context.Background(), insertQuery, newBranchID, businessID, branchName)
 			if err != nil {
 				return err
@@ -107,11 +107,11 @@ func UpdateBranchesForSubscription(subscriptionID string, branchChange int, bran
 	// Removing branches
 	if branchChange < 0 {
 		if len(branchNames) < -branchChange {
-			return errors.New("not enough branch names provided for the number of branches to remove")
+			return apperrors.Validation("not enough branch names provided for the number of branches to remove")
 		}
 
 		for _, branchName := range branchNames[:(-branchChange)] {
-			deleteQuery := `DELETE FROM branches WHERE businessId = $1 AND location = $2`
+			deleteQuery := `DELETE FROM branches WHERE business_id = $1 AND location = $2`
 			_, err := pool.Exec(context.Background(), deleteQuery, businessID, branchName)
 			if err != nil {
 				return err
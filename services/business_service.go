@@ -2,14 +2,15 @@ package services
 
 import (
 	"context"
-	"errors"
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func GetAllBusinesses(pool *pgxpool.Pool) ([]models.Business, error) {
-	rows, err := pool.Query(context.Background(), "SELECT id, vendor_id, name, description, deleted_at FROM businesses")
+	rows, err := pool.Query(context.Background(), "SELECT id, vendor_id, name, description, deleted_at FROM businesses WHERE deleted_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +29,7 @@ func GetAllBusinesses(pool *pgxpool.Pool) ([]models.Business, error) {
 }
 
 func CreateBusiness(business *models.Business, pool *pgxpool.Pool) error {
-	existingQuery := `SELECT COUNT(*) FROM businesses WHERE name = $1 AND vendor_id = $2`
+	existingQuery := `SELECT COUNT(*) FROM businesses WHERE name = $1 AND vendor_id = $2 AND deleted_at IS NULL`
 	var count int
 	err := pool.QueryRow(context.Background(), existingQuery, business.Name, business.VendorID).Scan(&count)
 	if err != nil {
@@ -36,56 +37,74 @@ func CreateBusiness(business *models.Business, pool *pgxpool.Pool) error {
 	}
 
 	if count > 0 {
-		return errors.New("business with the same name already exists for this vendor")
+		return apperrors.Conflict("business with the same name already exists for this vendor")
 	}
 
 	query := `INSERT INTO businesses (id, vendor_id, name, description, deleted_at) VALUES ($1, $2, $3, $4, $5)`
 	_, err = pool.Exec(context.Background(), query, business.ID, business.VendorID, business.Name, business.Description, business.DeletedAt)
-	return err
+	if err != nil {
+		return err
+	}
+
+	notifyResourceChange(ResourceBusiness)
+	return nil
 }
 
 func GetBusinessByID(businessID uuid.UUID, pool *pgxpool.Pool) (*models.Business, error) {
-	query := `SELECT id, vendor_id, name, description, deleted_at FROM businesses WHERE id = $1`
+	query := `SELECT id, vendor_id, name, description, deleted_at FROM businesses WHERE id = $1 AND deleted_at IS NULL`
 	row := pool.QueryRow(context.Background(), query, businessID)
 
 	var business models.Business
 	if err := row.Scan(&business.ID, &business.VendorID, &business.Name, &business.Description, &business.DeletedAt); err != nil {
-		return nil, err
+		return nil, notFoundOr(err, "business not found")
 	}
 
 	return &business, nil
 }
 
 func UpdateBusiness(business *models.Business, pool *pgxpool.Pool) error {
-	query := `UPDATE businesses SET vendor_id = $2, name = $3, description = $4, deleted_at = $5 WHERE id = $1`
-	cmdTag, err := pool.Exec(context.Background(), query, business.ID, business.VendorID, business.Name, business.Description, business.DeletedAt)
+	// vendor_id is deliberately left untouched: ownership cannot be transferred through an update.
+	query := `UPDATE businesses SET name = $2, description = $3 WHERE id = $1 AND deleted_at IS NULL`
+	cmdTag, err := pool.Exec(context.Background(), query, business.ID, business.Name, business.Description)
 	if err != nil {
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were updated, business not found")
+		return apperrors.NotFound("no rows were updated, business not found")
 	}
 
+	notifyResourceChange(ResourceBusiness)
 	return nil
 }
 
+// DeleteBusiness soft-deletes the business so its payments and invoices are
+// kept, and cancels its active subscriptions so billing stops.
 func DeleteBusiness(businessID uuid.UUID, pool *pgxpool.Pool) error {
-	query := `DELETE FROM businesses WHERE id = $1`
-	cmdTag, err := pool.Exec(context.Background(), query, businessID)
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		query := `UPDATE businesses SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+		cmdTag, err := tx.Exec(ctx, query, businessID)
+		if err != nil {
+			return err
+		}
+		if cmdTag.RowsAffected() == 0 {
+			return apperrors.NotFound("no rows were deleted, business not found")
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE subscriptions SET status = 'canceled' WHERE business_id = $1 AND status = 'active'`, businessID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were deleted, business not found")
-	}
-
+	notifyResourceChange(ResourceBusiness)
 	return nil
 }
 
 func GetBusinessesByVendorID(vendorID uuid.UUID, pool *pgxpool.Pool) ([]models.Business, error) {
-	query := `SELECT id, vendor_id, name, description, deleted_at FROM businesses WHERE vendor_id = $1`
+	query := `SELECT id, vendor_id, name, description, deleted_at FROM businesses WHERE vendor_id = $1 AND deleted_at IS NULL`
 	rows, err := pool.Query(context.Background(), query, vendorID)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Bradkibs/MONOS-challenge/utils"
+)
+
+// backgroundTasks tracks work started by runInBackground so shutdown can
+// wait for it.
+var backgroundTasks sync.WaitGroup
+
+// runInBackground runs task without holding up the request that started it.
+func runInBackground(task func()) {
+	backgroundTasks.Add(1)
+	go func() {
+		defer backgroundTasks.Done()
+		task()
+	}()
+}
+
+// WaitForBackgroundTasks blocks until messages and other work started in the
+// background have finished, or ctx is done.
+func WaitForBackgroundTasks(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		backgroundTasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendMessage delivers message by text to a phone number or by email,
+// depending on channel.
+func sendMessage(channel, destination, subject, message string, sms utils.SMSSender, mail utils.EmailSender) error {
+	if channel == VerificationPhone {
+		return sms.SendSMS(destination, message)
+	}
+	return mail.SendEmail(destination, subject, message)
+}
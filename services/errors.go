@@ -0,0 +1,17 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/jackc/pgx/v5"
+)
+
+// notFoundOr turns pgx.ErrNoRows into a NotFound domain error carrying message
+// and returns any other error unchanged.
+func notFoundOr(err error, message string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperrors.NotFound(message)
+	}
+	return err
+}
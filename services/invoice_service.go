@@ -2,9 +2,9 @@ package services
 
 import (
 	"context"
-	"errors"
 	"time"
 
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/google/uuid"
@@ -13,14 +13,14 @@ import (
 
 func AddInvoice(invoice *models.Invoice, pool *pgxpool.Pool) error {
 	var paymentStatus string
-	queryPaymentStatus := `SELECT status FROM payments WHERE id = $1`
+	queryPaymentStatus := `SELECT status FROM payments WHERE id = $1 AND deleted_at IS NULL`
 	err := pool.QueryRow(context.Background(), queryPaymentStatus, invoice.PaymentID).Scan(&paymentStatus)
 	if err != nil {
-		return errors.New("payment not found")
+		return notFoundOr(err, "payment not found")
 	}
 
 	if paymentStatus != "completed" {
-		return errors.New("cannot create an invoice for a payment that is not completed")
+		return apperrors.Conflict("cannot create an invoice for a payment that is not completed")
 	}
 
 	query := `INSERT INTO invoices (id, payment_id, issue_date, due_date, status) VALUES ($1, $2, $3, $4, $5)`
@@ -29,41 +29,41 @@ func AddInvoice(invoice *models.Invoice, pool *pgxpool.Pool) error {
 }
 
 func GetInvoiceByID(invoiceID uuid.UUID, pool *pgxpool.Pool) (*models.Invoice, error) {
-	query := `SELECT id, payment_id, issue_date, due_date, status, deleted_at FROM invoices WHERE id = $1`
+	query := `SELECT id, payment_id, issue_date, due_date, status, deleted_at FROM invoices WHERE id = $1 AND deleted_at IS NULL`
 	row := pool.QueryRow(context.Background(), query, invoiceID)
 
 	var invoice models.Invoice
 	err := row.Scan(&invoice.ID, &invoice.PaymentID, &invoice.IssueDate, &invoice.DueDate, &invoice.Status, &invoice.DeletedAt)
 	if err != nil {
-		return nil, errors.New("invoice not found")
+		return nil, notFoundOr(err, "invoice not found")
 	}
 
 	return &invoice, nil
 }
 
 func UpdateInvoice(invoice *models.Invoice, pool *pgxpool.Pool) error {
-	query := `UPDATE invoices SET payment_id = $2, issue_date = $3, due_date = $4, status = $5 WHERE id = $1`
+	query := `UPDATE invoices SET payment_id = $2, issue_date = $3, due_date = $4, status = $5 WHERE id = $1 AND deleted_at IS NULL`
 	cmdTag, err := pool.Exec(context.Background(), query, invoice.ID, invoice.PaymentID, invoice.IssueDate, invoice.DueDate, invoice.Status)
 	if err != nil {
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were updated, invoice not found")
+		return apperrors.NotFound("no rows were updated, invoice not found")
 	}
 
 	return nil
 }
 
 func DeleteInvoice(invoiceID uuid.UUID, pool *pgxpool.Pool) error {
-	query := `UPDATE invoices SET deleted_at = $2 WHERE id = $1`
+	query := `UPDATE invoices SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`
 	cmdTag, err := pool.Exec(context.Background(), query, invoiceID, time.Now())
 	if err != nil {
 		return err
 	}
 
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were deleted, invoice not found")
+		return apperrors.NotFound("no rows were deleted, invoice not found")
 	}
 
 	return nil
@@ -71,14 +71,14 @@ func DeleteInvoice(invoiceID uuid.UUID, pool *pgxpool.Pool) error {
 
 func GenerateInvoiceForPayment(paymentID, userID uuid.UUID, pool *pgxpool.Pool) (*models.Invoice, error) {
 	var payment models.Payment
-	paymentQuery := `SELECT id, amount, date, status FROM payments WHERE id = $1`
+	paymentQuery := `SELECT id, amount, date, status FROM payments WHERE id = $1 AND deleted_at IS NULL`
 	err := pool.QueryRow(context.Background(), paymentQuery, paymentID).Scan(&payment.ID, &payment.Amount, &payment.Date, &payment.Status)
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return nil, notFoundOr(err, "payment not found")
 	}
 
 	if payment.Status != "completed" {
-		return nil, errors.New("cannot generate an invoice for a payment that is not completed")
+		return nil, apperrors.Conflict("cannot generate an invoice for a payment that is not completed")
 	}
 
 	invoice := &models.Invoice{
@@ -98,7 +98,7 @@ func GenerateInvoiceForPayment(paymentID, userID uuid.UUID, pool *pgxpool.Pool)
 }
 
 func GetAllInvoices(pool *pgxpool.Pool) ([]models.Invoice, error) {
-	query := `SELECT id, payment_id, issue_date, due_date, status, deleted_at FROM invoices`
+	query := `SELECT id, payment_id, issue_date, due_date, status, deleted_at FROM invoices WHERE deleted_at IS NULL`
 	rows, err := pool.Query(context.Background(), query)
 	if err != nil {
 		return nil, err
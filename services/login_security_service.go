@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Login attempt outcomes recorded in the audit table.
+const (
+	LoginSuccess            = "success"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginLocked             = "locked"
+	LoginIPBlocked          = "ip_blocked"
+	LoginMFARequired        = "mfa_required"
+	LoginMFAFailed          = "mfa_failed"
+)
+
+const (
+	// lockoutThreshold consecutive failures lock an account for one minute;
+	// each further failure doubles the lock up to maxLockout.
+	lockoutThreshold = 5
+	maxLockout       = time.Hour
+	// An IP is refused for ipFailureWindow after ipFailureLimit failed
+	// sign-ins across all accounts.
+	ipFailureLimit  = 20
+	ipFailureWindow = 15 * time.Minute
+)
+
+// LoginClient describes where a sign-in comes from.
+type LoginClient struct {
+	IP        string
+	UserAgent string
+}
+
+func ipLoginBlocked(ctx context.Context, pool *pgxpool.Pool, ip string) (bool, error) {
+	if ip == "" {
+		return false, nil
+	}
+	var failures int
+	query := `SELECT COUNT(*) FROM login_attempts WHERE ip = $1 AND outcome = $2 AND created_at > $3`
+	err := pool.QueryRow(ctx, query, ip, LoginInvalidCredentials, time.Now().Add(-ipFailureWindow)).Scan(&failures)
+	return failures >= ipFailureLimit, err
+}
+
+// registerFailedLogin counts a failure against the account and returns the
+// lock that is now in place, if any. Wrong passwords and wrong second
+// factors count alike.
+func registerFailedLogin(ctx context.Context, db queryRower, userID uuid.UUID) (*time.Time, error) {
+	var lockedUntil *time.Time
+	query := `
+		UPDATE users SET
+			failed_login_count = failed_login_count + 1,
+			locked_until = CASE WHEN failed_login_count + 1 >= $2
+				THEN NOW() + LEAST(POWER(2, LEAST(failed_login_count + 1 - $2, 16)), $3) * INTERVAL '1 minute'
+				ELSE locked_until END
+		WHERE id = $1
+		RETURNING locked_until`
+	err := db.QueryRow(ctx, query, userID, lockoutThreshold, int(maxLockout.Minutes())).Scan(&lockedUntil)
+	return lockedUntil, err
+}
+
+func clearFailedLogins(ctx context.Context, db execer, userID uuid.UUID) error {
+	_, err := db.Exec(ctx, `UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1`, userID)
+	return err
+}
+
+// recordLoginAttempt writes the audit entry. Failures are logged rather than
+// returned so auditing never decides the outcome of a sign-in.
+func recordLoginAttempt(ctx context.Context, pool *pgxpool.Pool, userID *uuid.UUID, identifier string, client LoginClient, outcome string) {
+	query := `INSERT INTO login_attempts (id, user_id, identifier, ip, user_agent, outcome) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := pool.Exec(ctx, query, uuid.New(), userID, truncate(identifier, 255), truncate(client.IP, 45), truncate(client.UserAgent, 512), outcome)
+	if err != nil {
+		slog.Error("failed to record login attempt", slog.String("event.outcome", outcome), logging.Err(err))
+	}
+}
+
+// lockedError tells the caller how long to wait before trying again.
+func lockedError(lockedUntil time.Time) error {
+	minutes := int(time.Until(lockedUntil).Minutes()) + 1
+	return apperrors.TooManyRequests(fmt.Sprintf("account is temporarily locked after too many failed sign-ins, try again in %d minute(s)", minutes))
+}
+
+// rememberDevice records the device a user signed in from and notifies the
+// user when it is new. The first device of an account is not reported.
+func rememberDevice(ctx context.Context, pool *pgxpool.Pool, userID uuid.UUID, email *string, client LoginClient, mail utils.EmailSender) {
+	fingerprint := sha256.Sum256([]byte(client.UserAgent))
+
+	cmdTag, err := pool.Exec(ctx, `UPDATE user_devices SET last_seen_at = NOW(), last_ip = $3 WHERE user_id = $1 AND fingerprint = $2`,
+		userID, fingerprint[:], truncate(client.IP, 45))
+	if err != nil || cmdTag.RowsAffected() > 0 {
+		if err != nil {
+			slog.Error("failed to update user device", slog.String("user.id", userID.String()), logging.Err(err))
+		}
+		return
+	}
+
+	// The count runs on the snapshot before the insert, so it is the number
+	// of devices seen before this one.
+	var otherDevices int
+	query := `
+		WITH inserted AS (
+			INSERT INTO user_devices (user_id, fingerprint, user_agent, last_ip) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, fingerprint) DO NOTHING
+			RETURNING 1
+		)
+		SELECT CASE WHEN EXISTS (SELECT 1 FROM inserted)
+			THEN (SELECT COUNT(*) FROM user_devices WHERE user_id = $1) ELSE 0 END`
+	err = pool.QueryRow(ctx, query, userID, fingerprint[:], truncate(client.UserAgent, 512), truncate(client.IP, 45)).Scan(&otherDevices)
+	if err != nil {
+		slog.Error("failed to record user device", slog.String("user.id", userID.String()), logging.Err(err))
+		return
+	}
+	if otherDevices == 0 {
+		return
+	}
+
+	device := client.UserAgent
+	if device == "" {
+		device = "an unknown device"
+	}
+	message := fmt.Sprintf("New sign-in to your account from %s (IP %s) at %s. If this was not you, reset your password.",
+		device, client.IP, time.Now().UTC().Format(time.RFC1123))
+
+	if err := CreateNotification(pool, &models.Notification{UserID: userID, Type: "Security", Message: message}); err != nil {
+		slog.Error("failed to log notification", slog.String("user.id", userID.String()), logging.Err(err))
+	}
+	if email != nil && *email != "" {
+		if err := mail.SendEmail(*email, "New sign-in to your account", message); err != nil {
+			slog.Error("failed to send new device alert", slog.String("user.id", userID.String()), logging.Err(err))
+		}
+	}
+}
+
+// truncate cuts value to at most length bytes without splitting a character.
+func truncate(value string, length int) string {
+	if len(value) > length {
+		return strings.ToValidUTF8(value[:length], "")
+	}
+	return value
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	MFAChallengeTTL = 5 * time.Minute
+	// mfaChallengeMaxAttempts is the number of wrong codes a challenge
+	// survives.
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+
+	// TOTP parameters (RFC 6238), the defaults every authenticator app
+	// supports.
+	totpIssuer = "MONOS"
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts codes from this many periods before or after the
+	// current one to allow for clock drift.
+	totpSkew = 1
+)
+
+// queryRower is satisfied by both *pgxpool.Pool and pgx.Tx.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// mfaRequired reports whether the user has to pass a second factor to sign
+// in.
+func mfaRequired(ctx context.Context, db queryRower, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL)`
+	err := db.QueryRow(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// newMFAChallenge records the second login step for the user. identifier is
+// what the user signed in with, kept for the login audit.
+func newMFAChallenge(ctx context.Context, db execer, userID uuid.UUID, identifier string) (*models.MFAChallenge, error) {
+	if _, err := db.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < NOW()`); err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(MFAChallengeTTL)
+	query := `INSERT INTO mfa_challenges (id, user_id, token_hash, identifier, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := db.Exec(ctx, query, uuid.New(), userID, hashRefreshToken(token), truncate(identifier, 255), expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &models.MFAChallenge{MFARequired: true, Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyMFAChallenge completes a sign-in with a TOTP or recovery code and
+// returns tokens for a session marked as established with a second factor.
+// Wrong codes count towards the account lockout like wrong passwords, and a
+// locked account cannot complete a challenge.
+func VerifyMFAChallenge(challengeToken, code string, client LoginClient, mail utils.EmailSender, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	ctx := context.Background()
+
+	var tokens *models.TokenPair
+	var userID uuid.UUID
+	var identifier string
+	var email *string
+	var rejection error
+	outcome := LoginMFAFailed
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var challengeID uuid.UUID
+		var attempts int
+		var expiresAt time.Time
+		var consumedAt *time.Time
+		query := `SELECT id, user_id, identifier, attempts, expires_at, consumed_at FROM mfa_challenges WHERE token_hash = $1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, hashRefreshToken(challengeToken)).Scan(&challengeID, &userID, &identifier, &attempts, &expiresAt, &consumedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			rejection = apperrors.Unauthorized("invalid MFA token")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if consumedAt != nil || attempts >= mfaChallengeMaxAttempts || time.Now().After(expiresAt) {
+			rejection = apperrors.Unauthorized("MFA token has expired, please sign in again")
+			return nil
+		}
+
+		var phoneNumber *string
+		var role string
+		var lockedUntil *time.Time
+		query = `SELECT email, phone_number, role, locked_until FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, userID).Scan(&email, &phoneNumber, &role, &lockedUntil); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				rejection = apperrors.Unauthorized("account is deactivated")
+				return nil
+			}
+			return err
+		}
+		if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+			rejection, outcome = lockedError(*lockedUntil), LoginLocked
+			return nil
+		}
+
+		ok, err := verifySecondFactor(ctx, tx, userID, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			rejection = apperrors.Unauthorized("invalid authentication code")
+			if _, err := tx.Exec(ctx, `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, challengeID); err != nil {
+				return err
+			}
+			lockedUntil, err := registerFailedLogin(ctx, tx, userID)
+			if err != nil {
+				return err
+			}
+			if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+				rejection = lockedError(*lockedUntil)
+			}
+			return nil
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE mfa_challenges SET consumed_at = NOW() WHERE id = $1`, challengeID); err != nil {
+			return err
+		}
+		if err := clearFailedLogins(ctx, tx, userID); err != nil {
+			return err
+		}
+		tokens, err = issueTokens(ctx, tx, uuid.New(), userID, tokenSubject(email, phoneNumber), role, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rejection != nil {
+		if userID != uuid.Nil {
+			recordLoginAttempt(ctx, pool, &userID, identifier, client, outcome)
+		}
+		return nil, rejection
+	}
+
+	recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginSuccess)
+	runInBackground(func() { rememberDevice(context.Background(), pool, userID, email, client, mail) })
+	return tokens, nil
+}
+
+// BeginMFAEnrollment creates a new TOTP secret for the user. It takes effect
+// once ConfirmMFAEnrollment has seen a code generated from it.
+func BeginMFAEnrollment(claims *models.Claims, pool *pgxpool.Pool) (*models.MFAEnrollment, error) {
+	ctx := context.Background()
+
+	enabled, err := mfaRequired(ctx, pool, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, apperrors.Conflict("two-factor authentication is already enabled")
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	sealed, err := sealMFASecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL`
+	cmdTag, err := pool.Exec(ctx, query, claims.UserID, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return nil, apperrors.Conflict("two-factor authentication is already enabled")
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	return &models.MFAEnrollment{Secret: encoded, ProvisioningURI: provisioningURI(claims.Email, encoded)}, nil
+}
+
+// ConfirmMFAEnrollment enables two-factor authentication once the user
+// proves their authenticator works. It returns the recovery codes, which are
+// shown only once, and a new session: every other session is revoked.
+func ConfirmMFAEnrollment(claims *models.Claims, code string, pool *pgxpool.Pool) ([]string, *models.TokenPair, error) {
+	ctx := context.Background()
+
+	var recoveryCodes []string
+	var tokens *models.TokenPair
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var sealed []byte
+		var enabledAt *time.Time
+		query := `SELECT secret, enabled_at FROM user_mfa WHERE user_id = $1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, claims.UserID).Scan(&sealed, &enabledAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperrors.Validation("start two-factor enrollment first")
+		}
+		if err != nil {
+			return err
+		}
+		if enabledAt != nil {
+			return apperrors.Conflict("two-factor authentication is already enabled")
+		}
+
+		secret, err := openMFASecret(sealed)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, code, 0, time.Now())
+		if !ok {
+			return apperrors.Validation("invalid authentication code")
+		}
+
+		query = `UPDATE user_mfa SET enabled_at = NOW(), last_used_step = $2 WHERE user_id = $1`
+		if _, err := tx.Exec(ctx, query, claims.UserID, step); err != nil {
+			return err
+		}
+		if recoveryCodes, err = replaceRecoveryCodes(ctx, tx, claims.UserID); err != nil {
+			return err
+		}
+		if err := revokeUserTokens(ctx, tx, claims.UserID); err != nil {
+			return err
+		}
+
+		var email, phoneNumber *string
+		var role string
+		query = `SELECT email, phone_number, role FROM users WHERE id = $1`
+		if err := tx.QueryRow(ctx, query, claims.UserID).Scan(&email, &phoneNumber, &role); err != nil {
+			return notFoundOr(err, "user not found")
+		}
+		tokens, err = issueTokens(ctx, tx, uuid.New(), claims.UserID, tokenSubject(email, phoneNumber), role, true)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return recoveryCodes, tokens, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// a current TOTP or recovery code.
+func RegenerateRecoveryCodes(claims *models.Claims, code string, pool *pgxpool.Pool) ([]string, error) {
+	ctx := context.Background()
+
+	var recoveryCodes []string
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		ok, err := verifySecondFactor(ctx, tx, claims.UserID, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return apperrors.Validation("invalid authentication code")
+		}
+		recoveryCodes, err = replaceRecoveryCodes(ctx, tx, claims.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking a current
+// TOTP or recovery code. Administrators cannot opt out.
+func DisableMFA(claims *models.Claims, code string, pool *pgxpool.Pool) error {
+	if claims.Role == models.RoleAdmin {
+		return apperrors.Forbidden("two-factor authentication is mandatory for administrators")
+	}
+
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		ok, err := verifySecondFactor(ctx, tx, claims.UserID, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return apperrors.Validation("invalid authentication code")
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, claims.UserID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, claims.UserID)
+		return err
+	})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+// Both are single-use: a TOTP step is not accepted twice.
+func verifySecondFactor(ctx context.Context, tx pgx.Tx, userID uuid.UUID, code string) (bool, error) {
+	var sealed []byte
+	var lastUsedStep int64
+	query := `SELECT secret, last_used_step FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL FOR UPDATE`
+	err := tx.QueryRow(ctx, query, userID).Scan(&sealed, &lastUsedStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, apperrors.Validation("two-factor authentication is not enabled")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) == totpDigits {
+		secret, err := openMFASecret(sealed)
+		if err != nil {
+			return false, err
+		}
+		step, ok := matchTOTP(secret, code, lastUsedStep, time.Now())
+		if !ok {
+			return false, nil
+		}
+		_, err = tx.Exec(ctx, `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1`, userID, step)
+		return err == nil, err
+	}
+
+	query = `UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	cmdTag, err := tx.Exec(ctx, query, userID, hashRecoveryCode(userID, code))
+	if err != nil {
+		return false, err
+	}
+	return cmdTag.RowsAffected() == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+
+		query := `INSERT INTO mfa_recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(ctx, query, uuid.New(), userID, hashRecoveryCode(userID, codes[i])); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely.
+func hashRecoveryCode(userID uuid.UUID, code string) []byte {
+	code = strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	mac := hmac.New(sha256.New, mfaKey())
+	mac.Write([]byte(userID.String() + ":" + code))
+	return mac.Sum(nil)
+}
+
+// totpCode computes the RFC 6238 code for a time step.
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// matchTOTP checks code against the steps around now and returns the step
+// that matched. Steps up to lastUsedStep are refused so a code works once.
+func matchTOTP(secret []byte, code string, lastUsedStep int64, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastUsedStep && hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func provisioningURI(account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totpIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// mfaKey derives the key protecting TOTP secrets and recovery codes from
+// MFA_ENCRYPTION_KEY, falling back to JWT_SECRET. Changing it invalidates
+// every enrollment.
+func mfaKey() []byte {
+	secret := os.Getenv("MFA_ENCRYPTION_KEY")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+// sealMFASecret encrypts a TOTP secret with AES-GCM; the nonce is prepended.
+func sealMFASecret(secret []byte) ([]byte, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, secret, nil), nil
+}
+
+func openMFASecret(sealed []byte) ([]byte, error) {
+	gcm, err := mfaCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed MFA secret")
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt MFA secret: %w", err)
+	}
+	return secret, nil
+}
+
+func mfaCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(mfaKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
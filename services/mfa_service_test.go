@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// The RFC lists eight digit codes; six digit codes are their last six.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Secret, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name         string
+		code         string
+		lastUsedStep int64
+		wantStep     int64
+		wantOK       bool
+	}{
+		{"current step", totpCode(rfc6238Secret, current), 0, current, true},
+		{"previous step within skew", totpCode(rfc6238Secret, current-1), 0, current - 1, true},
+		{"next step within skew", totpCode(rfc6238Secret, current+1), 0, current + 1, true},
+		{"outside skew", totpCode(rfc6238Secret, current-2), 0, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"replayed step", totpCode(rfc6238Secret, current), current, 0, false},
+		{"earlier step after a later one was used", totpCode(rfc6238Secret, current-1), current, 0, false},
+		{"later step after an earlier one was used", totpCode(rfc6238Secret, current+1), current, current + 1, true},
+	}
+	for _, tt := range tests {
+		step, ok := matchTOTP(rfc6238Secret, tt.code, tt.lastUsedStep, now)
+		if ok != tt.wantOK || step != tt.wantStep {
+			t.Errorf("%s: matchTOTP = %d, %v, want %d, %v", tt.name, step, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+}
+
+func TestMatchTOTPRefusesReuse(t *testing.T) {
+	now := time.Unix(2000000000, 0)
+	code := totpCode(rfc6238Secret, now.Unix()/totpPeriod)
+
+	step, ok := matchTOTP(rfc6238Secret, code, 0, now)
+	if !ok {
+		t.Fatal("first use of the code was refused")
+	}
+	if _, ok := matchTOTP(rfc6238Secret, code, step, now.Add(10*time.Second)); ok {
+		t.Fatal("the same code was accepted twice")
+	}
+}
+
+func TestVerifyMFAChallengeLocksAccountAfterWrongCodes(t *testing.T) {
+	pool := testPool(t)
+	email, password := uniqueEmail(), "Passw0rd!"
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	claims := &models.Claims{UserID: uuid.New(), Email: email, Role: models.RoleUser}
+	query := `INSERT INTO users (id, email, password, role, email_verified_at) VALUES ($1, $2, $3, 'user', NOW())`
+	if _, err := pool.Exec(context.Background(), query, claims.UserID, email, hashedPassword); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	enrollment, err := BeginMFAEnrollment(claims, pool)
+	if err != nil {
+		t.Fatalf("BeginMFAEnrollment: %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	step := time.Now().Unix() / totpPeriod
+	if _, _, err := ConfirmMFAEnrollment(claims, totpCode(secret, step), pool); err != nil {
+		t.Fatalf("ConfirmMFAEnrollment: %v", err)
+	}
+
+	mail := utils.NewMockEmailSender()
+	// Each wrong code gets a fresh challenge, so only the account lockout can
+	// stop the guessing.
+	for i := 1; i <= lockoutThreshold; i++ {
+		result, err := LoginUser(email, password, testLoginClient, mail, pool)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		_, err = VerifyMFAChallenge(result.Challenge.Token, "not-a-code", testLoginClient, mail, pool)
+		want := apperrors.ErrUnauthorized
+		if i == lockoutThreshold {
+			want = apperrors.ErrTooManyRequests
+		}
+		if !errors.Is(err, want) {
+			t.Fatalf("wrong code %d: err = %v, want %v", i, err, want)
+		}
+	}
+
+	if _, err := LoginUser(email, password, testLoginClient, mail, pool); !errors.Is(err, apperrors.ErrTooManyRequests) {
+		t.Fatalf("login while locked: err = %v, want too many requests", err)
+	}
+
+	// A challenge issued before the lock cannot be completed either.
+	challenge, err := newMFAChallenge(context.Background(), pool, claims.UserID, email)
+	if err != nil {
+		t.Fatalf("newMFAChallenge: %v", err)
+	}
+	if _, err := VerifyMFAChallenge(challenge.Token, totpCode(secret, step+1), testLoginClient, mail, pool); !errors.Is(err, apperrors.ErrTooManyRequests) {
+		t.Fatalf("correct code while locked: err = %v, want too many requests", err)
+	}
+}
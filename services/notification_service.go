@@ -2,11 +2,12 @@ package services
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/google/uuid"
@@ -15,9 +16,9 @@ import (
 
 func CreateNotification(pool *pgxpool.Pool, notification *models.Notification) error {
 	query := `
-		INSERT INTO notifications (user_id, invoice_id, type, message, createdat, updatedat, deletedat)
+		INSERT INTO notifications (user_id, invoice_id, type, message, created_at, updated_at, deleted_at)
 		VALUES ($1, $2, $3, $4, NOW(), NOW(), NULL)
-		RETURNING id, createdat, updatedat
+		RETURNING id, created_at, updated_at
 	`
 	err := pool.QueryRow(
 		context.Background(),
@@ -37,8 +38,8 @@ func CreateNotification(pool *pgxpool.Pool, notification *models.Notification) e
 
 func GetNotificationByID(pool *pgxpool.Pool, id uuid.UUID) (*models.Notification, error) {
 	query := `
-		SELECT id, user_id, invoice_id, type, message, createdat, updatedat, deletedat
-		FROM notifications WHERE id = $1 AND deletedat IS NULL
+		SELECT id, user_id, invoice_id, type, message, created_at, updated_at, deleted_at
+		FROM notifications WHERE id = $1 AND deleted_at IS NULL
 	`
 	notification := &models.Notification{}
 	err := pool.QueryRow(context.Background(), query, id).Scan(
@@ -52,36 +53,48 @@ func GetNotificationByID(pool *pgxpool.Pool, id uuid.UUID) (*models.Notification
 		&notification.DeletedAt,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve notification by ID: %w", err)
+		return nil, notFoundOr(err, "notification not found")
 	}
 	return notification, nil
 }
 
-func GetNotificationByUserID(pool *pgxpool.Pool, userId uuid.UUID) (*models.Notification, error) {
+func GetNotificationsByUserID(pool *pgxpool.Pool, userId uuid.UUID) ([]models.Notification, error) {
 	query := `
-		SELECT id, user_id, invoice_id, type, message, createdat, updatedat, deletedat
-		FROM notifications WHERE user_id = $1 AND deletedat IS NULL
+		SELECT id, user_id, invoice_id, type, message, created_at, updated_at, deleted_at
+		FROM notifications WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC
 	`
-	notification := &models.Notification{}
-	err := pool.QueryRow(context.Background(), query, userId).Scan(
-		&notification.ID,
-		&notification.UserID,
-		&notification.InvoiceID,
-		&notification.Type,
-		&notification.Message,
-		&notification.CreatedAt,
-		&notification.UpdatedAt,
-		&notification.DeletedAt,
-	)
+	rows, err := pool.Query(context.Background(), query, userId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve notification by ID: %w", err)
+		return nil, fmt.Errorf("failed to retrieve notifications by user ID: %w", err)
 	}
-	return notification, nil
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		if err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.InvoiceID,
+			&notification.Type,
+			&notification.Message,
+			&notification.CreatedAt,
+			&notification.UpdatedAt,
+			&notification.DeletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
 }
+
 func GetNotificationByInvoiceID(pool *pgxpool.Pool, invoiceId uuid.UUID) (*models.Notification, error) {
 	query := `
-		SELECT id, user_id, invoice_id, type, message, createdat, updatedat, deletedat
-		FROM notifications WHERE invoice_id = $1 AND deletedat IS NULL
+		SELECT id, user_id, invoice_id, type, message, created_at, updated_at, deleted_at
+		FROM notifications WHERE invoice_id = $1 AND deleted_at IS NULL
 	`
 	notification := &models.Notification{}
 	err := pool.QueryRow(context.Background(), query, invoiceId).Scan(
@@ -95,14 +108,14 @@ func GetNotificationByInvoiceID(pool *pgxpool.Pool, invoiceId uuid.UUID) (*model
 		&notification.DeletedAt,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve notification by ID: %w", err)
+		return nil, notFoundOr(err, "notification not found")
 	}
 	return notification, nil
 }
 
 func UpdateNotification(pool *pgxpool.Pool, notification *models.Notification) error {
 	query := `
-		UPDATE notifications SET type = $1, message = $2, updatedat = NOW() WHERE id = $3 AND deletedat IS NULL
+		UPDATE notifications SET type = $1, message = $2, updated_at = NOW() WHERE id = $3 AND deleted_at IS NULL
 	`
 	cmdTag, err := pool.Exec(
 		context.Background(),
@@ -115,33 +128,33 @@ func UpdateNotification(pool *pgxpool.Pool, notification *models.Notification) e
 		return fmt.Errorf("failed to update notification: %w", err)
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were updated, notification not found")
+		return apperrors.NotFound("no rows were updated, notification not found")
 	}
 	return nil
 }
 
 func DeleteNotification(pool *pgxpool.Pool, id uuid.UUID) error {
-	query := `UPDATE notifications SET deletedat = NOW() WHERE id = $1 AND deletedat IS NULL`
+	query := `UPDATE notifications SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
 	cmdTag, err := pool.Exec(context.Background(), query, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete notification: %w", err)
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were deleted, notification not found")
+		return apperrors.NotFound("no rows were deleted, notification not found")
 	}
 	return nil
 }
 
-func SendReminderNotification(pool *pgxpool.Pool) error {
+func SendReminderNotification(pool *pgxpool.Pool, mail utils.EmailSender) error {
 	query := `
-		SELECT i.id, i.duedate, p.amount, u.id AS user_id, u.email
+		SELECT i.id, i.due_date, p.amount, u.id AS user_id, u.email
 		FROM invoices i
-		JOIN payments p ON i.paymentid = p.id
-		JOIN subscriptions s ON p.subscriptionid = s.id
-		JOIN businesses b ON s.businessid = b.id
-		JOIN users u ON b.vendorid = u.id
-		WHERE i.status != 'paid' AND i.duedate <= NOW() + INTERVAL '3 days'
-		AND i.deletedat IS NULL
+		JOIN payments p ON i.payment_id = p.id
+		JOIN subscriptions s ON p.subscription_id = s.id
+		JOIN businesses b ON s.business_id = b.id
+		JOIN users u ON b.vendor_id = u.id
+		WHERE i.status != 'paid' AND i.due_date <= NOW() + INTERVAL '3 days'
+		AND i.deleted_at IS NULL
 	`
 	rows, err := pool.Query(context.Background(), query)
 	if err != nil {
@@ -156,13 +169,13 @@ func SendReminderNotification(pool *pgxpool.Pool) error {
 		var amount float64
 
 		if err := rows.Scan(&invoiceID, &dueDate, &amount, &userID, &email); err != nil {
-			log.Printf("failed to scan invoice data: %v", err)
+			slog.Error("failed to scan invoice data", logging.Err(err))
 			continue
 		}
 
 		message := fmt.Sprintf("Reminder: Your payment of $%.2f is due on %s.", amount, dueDate.Format("2006-01-02"))
-		if err := utils.SendEmail(email, "Payment Reminder", message); err != nil {
-			log.Printf("failed to send reminder to %s: %v", email, err)
+		if err := mail.SendEmail(email, "Payment Reminder", message); err != nil {
+			slog.Error("failed to send reminder", slog.String("invoice.id", invoiceID.String()), slog.String("user.id", userID.String()), logging.Err(err))
 		}
 
 		if err := CreateNotification(pool, &models.Notification{
@@ -171,7 +184,7 @@ func SendReminderNotification(pool *pgxpool.Pool) error {
 			Type:      "Reminder",
 			Message:   message,
 		}); err != nil {
-			log.Printf("failed to log notification for user %s: %v", userID, err)
+			slog.Error("failed to log notification", slog.String("user.id", userID.String()), logging.Err(err))
 		}
 	}
 
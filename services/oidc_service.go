@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/oauth2"
+)
+
+// OIDCLoginTTL bounds the time between starting a login and the provider
+// redirecting back to the callback.
+const OIDCLoginTTL = 10 * time.Minute
+
+// OIDCProvider is an OpenID Connect identity provider used for the
+// authorization code flow with PKCE.
+type OIDCProvider interface {
+	Name() string
+	// AuthCodeURL returns the provider URL the user is sent to in order to
+	// sign in.
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	// Exchange redeems an authorization code and returns the identity from
+	// the verified ID token. The token must carry nonce.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error)
+}
+
+// OIDCIdentity is the verified subset of ID token claims used to find or
+// create the local account.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCProviders maps provider names, as used in the /auth/oidc/:provider
+// routes, to providers.
+type OIDCProviders map[string]OIDCProvider
+
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// oidcProvider is an OIDCProvider backed by the issuer's discovery
+// document. Discovery runs on first use so that an unreachable provider does
+// not keep the API from starting.
+type oidcProvider struct {
+	cfg    OIDCProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCProvider(cfg OIDCProviderConfig) OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	return &oidcProvider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// OIDCProvidersFromEnv configures the providers listed in OIDC_PROVIDERS.
+// Each provider NAME reads OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and optionally
+// OIDC_<NAME>_SCOPES. The client secret may be empty for public clients.
+func OIDCProvidersFromEnv() (OIDCProviders, error) {
+	providers := OIDCProviders{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		}
+		if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL must be set", prefix, prefix, prefix)
+		}
+		providers[name] = NewOIDCProvider(cfg)
+	}
+	return providers, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	config, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := verifier.Verify(oidc.ClientContext(ctx, p.client), rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	return &OIDCIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery for %s failed: %w", p.cfg.Name, err)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// BeginOIDCLogin records a pending login and returns its state together with
+// the provider URL to redirect the user to. role applies only if the login
+// ends up creating a new account; cookie selects a browser session.
+func BeginOIDCLogin(provider OIDCProvider, role string, cookie bool, pool *pgxpool.Pool) (string, string, error) {
+	ctx := context.Background()
+
+	role, err := registrationRole(role)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	codeVerifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := pool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return "", "", err
+	}
+	query := `INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, role, cookie, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = pool.Exec(ctx, query, state, provider.Name(), nonce, codeVerifier, role, cookie, time.Now().Add(OIDCLoginTTL))
+	if err != nil {
+		return "", "", err
+	}
+
+	return state, authURL, nil
+}
+
+// CompleteOIDCLogin redeems the authorization code for the pending login
+// identified by state and signs the user in. It also reports whether the
+// login asked for a browser session.
+//
+// A known identity signs in its linked account. Otherwise the identity is
+// linked to the account with the same email address, or a new account is
+// created, but only when the provider has verified that address. Linking an
+// account whose address was never verified removes its password.
+//
+// The sign-in is subject to the same IP block and account lockout as a
+// password login and is recorded in the login audit table.
+func CompleteOIDCLogin(provider OIDCProvider, state, code string, client LoginClient, mail utils.EmailSender, pool *pgxpool.Pool) (*models.LoginResult, bool, error) {
+	ctx := context.Background()
+
+	var nonce, codeVerifier, role string
+	var cookie bool
+	var expiresAt time.Time
+	query := `DELETE FROM oidc_login_states WHERE state = $1 AND provider = $2 RETURNING nonce, code_verifier, role, cookie, expires_at`
+	err := pool.QueryRow(ctx, query, state, provider.Name()).Scan(&nonce, &codeVerifier, &role, &cookie, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && time.Now().After(expiresAt)) {
+		return nil, false, apperrors.Unauthorized("invalid or expired login state")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	identity, err := provider.Exchange(ctx, code, codeVerifier, nonce)
+	if err != nil {
+		slog.Warn("oidc login failed", slog.String("oidc.provider", provider.Name()), logging.Err(err))
+		return nil, false, apperrors.Unauthorized("could not verify the identity provider response")
+	}
+
+	// The identity's subject stands in for the identifier a password login
+	// would have typed until the account is known.
+	identifier := provider.Name() + ":" + identity.Subject
+	blocked, err := ipLoginBlocked(ctx, pool, client.IP)
+	if err != nil {
+		return nil, false, err
+	}
+	if blocked {
+		recordLoginAttempt(ctx, pool, nil, identifier, client, LoginIPBlocked)
+		return nil, false, apperrors.TooManyRequests("too many failed sign-ins from this address, please try again later")
+	}
+
+	var result models.LoginResult
+	var rejection error
+	var userID uuid.UUID
+	var email, phoneNumber *string
+	var lockedUntil *time.Time
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var userRole string
+		var deletedAt *time.Time
+
+		query := `
+			SELECT u.id, u.email, u.phone_number, u.role, u.deleted_at, u.locked_until
+			FROM user_identities i JOIN users u ON u.id = i.user_id
+			WHERE i.provider = $1 AND i.subject = $2`
+		err := tx.QueryRow(ctx, query, provider.Name(), identity.Subject).Scan(&userID, &email, &phoneNumber, &userRole, &deletedAt, &lockedUntil)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			if identity.Email == "" || !identity.EmailVerified {
+				rejection = apperrors.Forbidden("the identity provider did not return a verified email address")
+				return nil
+			}
+
+			var emailVerifiedAt *time.Time
+			query = `SELECT id, email, phone_number, role, deleted_at, email_verified_at, locked_until FROM users WHERE email = $1 FOR UPDATE`
+			err = tx.QueryRow(ctx, query, identity.Email).Scan(&userID, &email, &phoneNumber, &userRole, &deletedAt, &emailVerifiedAt, &lockedUntil)
+			switch {
+			case errors.Is(err, pgx.ErrNoRows):
+				userID, userRole, email = uuid.New(), role, &identity.Email
+				name := identity.Name
+				if len(name) > 255 {
+					name = ""
+				}
+				query = `INSERT INTO users (id, name, email, role, email_verified_at) VALUES ($1, $2, $3, $4, NOW())`
+				_, err = tx.Exec(ctx, query, userID, name, identity.Email, userRole)
+			case err == nil && deletedAt != nil:
+				rejection = apperrors.Unauthorized("account is deactivated")
+				return nil
+			case err == nil && emailVerifiedAt == nil:
+				// Whoever registered the address never proved they own it, so
+				// their password and sessions are dropped before the owner's
+				// identity is linked.
+				query = `UPDATE users SET password = NULL, email_verified_at = NOW() WHERE id = $1`
+				if _, err = tx.Exec(ctx, query, userID); err == nil {
+					err = revokeUserTokens(ctx, tx, userID)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			query = `INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`
+			if _, err := tx.Exec(ctx, query, provider.Name(), identity.Subject, userID, identity.Email); err != nil {
+				return err
+			}
+		}
+
+		if deletedAt != nil {
+			rejection = apperrors.Unauthorized("account is deactivated")
+			return nil
+		}
+		if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+			rejection = lockedError(*lockedUntil)
+			return nil
+		}
+
+		// The identity provider counts as the first factor only.
+		required, err := mfaRequired(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if required {
+			result.Challenge, err = newMFAChallenge(ctx, tx, userID, tokenSubject(email, phoneNumber))
+			return err
+		}
+
+		result.Tokens, err = issueTokens(ctx, tx, uuid.New(), userID, tokenSubject(email, phoneNumber), userRole, false)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if userID != uuid.Nil {
+		identifier = tokenSubject(email, phoneNumber)
+	}
+	switch {
+	case rejection != nil:
+		outcome := LoginInvalidCredentials
+		if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+			outcome = LoginLocked
+		}
+		var attemptUser *uuid.UUID
+		if userID != uuid.Nil {
+			attemptUser = &userID
+		}
+		recordLoginAttempt(ctx, pool, attemptUser, identifier, client, outcome)
+		return nil, false, rejection
+	case result.Challenge != nil:
+		recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginMFARequired)
+	default:
+		recordLoginAttempt(ctx, pool, &userID, identifier, client, LoginSuccess)
+		runInBackground(func() { rememberDevice(context.Background(), pool, userID, email, client, mail) })
+	}
+	return &result, cookie, nil
+}
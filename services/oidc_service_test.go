@@ -0,0 +1,550 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/migrations"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	testClientID     = "monos-test"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://api.example.com/auth/oidc/mock/callback"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, JWKS and a
+// token endpoint that enforces PKCE.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu            sync.Mutex
+	discoveryHits int
+	codes         map[string]mockGrant
+	tokenNonce    string // overrides the nonce put in the ID token when set
+	signingKey    *rsa.PrivateKey
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	m := &mockIssuer{key: key, signingKey: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() OIDCProvider {
+	return NewOIDCProvider(OIDCProviderConfig{
+		Name:         "mock",
+		IssuerURL:    m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.discoveryHits++
+	m.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize plays the user signing in at authURL and returns the code the
+// provider would send to the redirect URL.
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("auth URL lacks an S256 code challenge: %s", authURL)
+	}
+
+	code := uuid.NewString()
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	m.mu.Unlock()
+	return code
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testClientID || clientSecret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	m.mu.Lock()
+	grant, found := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	nonce := grant.nonce
+	if m.tokenNonce != "" {
+		nonce = m.tokenNonce
+	}
+	signingKey := m.signingKey
+	m.mu.Unlock()
+
+	verifierDigest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(verifierDigest[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(signingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func identityClaims(subject, email string, verified bool) jwt.MapClaims {
+	return jwt.MapClaims{"sub": subject, "email": email, "email_verified": verified, "name": "Test User"}
+}
+
+func TestOIDCProviderDiscoveryIsLazyAndCached(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	if issuer.discoveryHits != 0 {
+		t.Fatalf("discovery ran %d times before first use", issuer.discoveryHits)
+	}
+
+	for i := 0; i < 2; i++ {
+		authURL, err := provider.AuthCodeURL(context.Background(), "state-value", "nonce-value", "verifier-value-that-is-long-enough-for-pkce")
+		if err != nil {
+			t.Fatalf("AuthCodeURL: %v", err)
+		}
+		parsed, _ := url.Parse(authURL)
+		query := parsed.Query()
+		if parsed.Path != "/authorize" || query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL {
+			t.Errorf("auth URL = %s, want the discovered endpoint with client and redirect", authURL)
+		}
+		if query.Get("state") != "state-value" || query.Get("nonce") != "nonce-value" {
+			t.Errorf("auth URL state, nonce = %q, %q", query.Get("state"), query.Get("nonce"))
+		}
+		digest := sha256.Sum256([]byte("verifier-value-that-is-long-enough-for-pkce"))
+		if query.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(digest[:]) || query.Get("code_challenge_method") != "S256" {
+			t.Errorf("auth URL code challenge = %q (%s), want S256 of the verifier", query.Get("code_challenge"), query.Get("code_challenge_method"))
+		}
+	}
+
+	if issuer.discoveryHits != 1 {
+		t.Errorf("discovery ran %d times, want 1", issuer.discoveryHits)
+	}
+}
+
+func TestOIDCProviderDiscoveryFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	provider := NewOIDCProvider(OIDCProviderConfig{Name: "broken", IssuerURL: server.URL, ClientID: testClientID, RedirectURL: testRedirectURL})
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Fatal("AuthCodeURL succeeded without a discovery document")
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	verifier := "correct-verifier-correct-verifier-correct-verifier"
+
+	tests := []struct {
+		name       string
+		verifier   string
+		nonce      string
+		tokenNonce string
+		wrongKey   bool
+		wantErr    bool
+	}{
+		{name: "valid", verifier: verifier, nonce: "nonce-1"},
+		{name: "wrong code verifier", verifier: "another-verifier-another-verifier-another-verifier", nonce: "nonce-1", wantErr: true},
+		{name: "nonce mismatch", verifier: verifier, nonce: "nonce-1", tokenNonce: "nonce-2", wantErr: true},
+		{name: "token signed by unknown key", verifier: verifier, nonce: "nonce-1", wrongKey: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := newMockIssuer(t)
+			issuer.tokenNonce = tt.tokenNonce
+			if tt.wrongKey {
+				otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+				if err != nil {
+					t.Fatalf("GenerateKey: %v", err)
+				}
+				issuer.signingKey = otherKey
+			}
+			provider := issuer.provider()
+
+			authURL, err := provider.AuthCodeURL(context.Background(), "state", tt.nonce, verifier)
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+			code := issuer.authorize(t, authURL, identityClaims("subject-1", "jane@example.com", true))
+
+			identity, err := provider.Exchange(context.Background(), code, tt.verifier, tt.nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			want := OIDCIdentity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true, Name: "Test User"}
+			if *identity != want {
+				t.Errorf("identity = %+v, want %+v", *identity, want)
+			}
+		})
+	}
+}
+
+// testPool connects to the database in TEST_PG_DB and migrates it. Tests
+// that need Postgres are skipped when it is not set.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_PG_DB")
+	if databaseURL == "" {
+		t.Skip("TEST_PG_DB is not set")
+	}
+	t.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret-test")
+
+	pool, err := pgxpool.New(context.Background(), databaseURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := migrations.Up(context.Background(), pool); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return pool
+}
+
+// testLoginClient is the client test sign-ins come from. Without an IP it is
+// never blocked by the failures earlier runs recorded.
+var testLoginClient = LoginClient{UserAgent: "services-test"}
+
+// uniqueEmail keeps tests independent of rows left by earlier runs.
+func uniqueEmail() string {
+	return uuid.NewString() + "@example.com"
+}
+
+func oidcLogin(t *testing.T, issuer *mockIssuer, provider OIDCProvider, pool *pgxpool.Pool, claims jwt.MapClaims) (*models.LoginResult, error) {
+	t.Helper()
+	state, authURL, err := BeginOIDCLogin(provider, "", false, pool)
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, claims)
+	result, _, err := CompleteOIDCLogin(provider, state, code, testLoginClient, utils.NewMockEmailSender(), pool)
+	return result, err
+}
+
+func linkedUser(t *testing.T, pool *pgxpool.Pool, subject string) uuid.UUID {
+	t.Helper()
+	var userID uuid.UUID
+	err := pool.QueryRow(context.Background(), `SELECT user_id FROM user_identities WHERE provider = 'mock' AND subject = $1`, subject).Scan(&userID)
+	if err != nil {
+		t.Fatalf("identity %s is not linked: %v", subject, err)
+	}
+	return userID
+}
+
+func TestCompleteOIDCLoginRejectsUnknownOrReusedState(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	if _, _, err := CompleteOIDCLogin(provider, "unknown-state", "code", testLoginClient, utils.NewMockEmailSender(), pool); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("unknown state: err = %v, want unauthorized", err)
+	}
+
+	state, authURL, err := BeginOIDCLogin(provider, "", false, pool)
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, identityClaims(uuid.NewString(), uniqueEmail(), true))
+
+	other := NewOIDCProvider(OIDCProviderConfig{Name: "other", IssuerURL: issuer.server.URL, ClientID: testClientID, ClientSecret: testClientSecret, RedirectURL: testRedirectURL})
+	if _, _, err := CompleteOIDCLogin(other, state, code, testLoginClient, utils.NewMockEmailSender(), pool); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("state of another provider: err = %v, want unauthorized", err)
+	}
+	if _, _, err := CompleteOIDCLogin(provider, state, code, testLoginClient, utils.NewMockEmailSender(), pool); err != nil {
+		t.Fatalf("matching provider: %v", err)
+	}
+	// A completed login consumes its state.
+	if _, _, err := CompleteOIDCLogin(provider, state, code, testLoginClient, utils.NewMockEmailSender(), pool); !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("reused state: err = %v, want unauthorized", err)
+	}
+}
+
+func TestCompleteOIDCLoginCreatesAccountForVerifiedEmail(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	subject, email := uuid.NewString(), uniqueEmail()
+
+	result, err := oidcLogin(t, issuer, provider, pool, identityClaims(subject, email, true))
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if result.Tokens == nil || result.Tokens.AccessToken == "" {
+		t.Fatalf("first login returned no tokens: %+v", result)
+	}
+
+	userID := linkedUser(t, pool, subject)
+	var storedEmail, role string
+	var verified bool
+	err = pool.QueryRow(context.Background(), `SELECT email, role, email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&storedEmail, &role, &verified)
+	if err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if storedEmail != email || role != models.RoleUser || !verified {
+		t.Errorf("user = %s %s verified=%v, want %s user verified", storedEmail, role, verified, email)
+	}
+
+	// The linked identity signs in the same account again.
+	if _, err := oidcLogin(t, issuer, provider, pool, identityClaims(subject, email, true)); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again := linkedUser(t, pool, subject); again != userID {
+		t.Errorf("second login linked %s, want %s", again, userID)
+	}
+}
+
+func TestCompleteOIDCLoginRequiresVerifiedEmail(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	email := uniqueEmail()
+
+	_, err := oidcLogin(t, issuer, issuer.provider(), pool, identityClaims(uuid.NewString(), email, false))
+	if !errors.Is(err, apperrors.ErrForbidden) {
+		t.Fatalf("err = %v, want forbidden", err)
+	}
+
+	var exists bool
+	pool.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, email).Scan(&exists)
+	if exists {
+		t.Error("an account was created for an unverified email address")
+	}
+}
+
+func TestCompleteOIDCLoginLinksExistingAccountByVerifiedEmail(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		emailVerified bool
+		wantPassword  bool
+	}{
+		{name: "verified local account keeps its password", emailVerified: true, wantPassword: true},
+		{name: "unverified local account loses its password", emailVerified: false, wantPassword: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashedPassword, err := HashPassword("Sup3r$ecret")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+			userID, email := uuid.New(), uniqueEmail()
+			query := `INSERT INTO users (id, email, password, role, email_verified_at) VALUES ($1, $2, $3, 'vendor', CASE WHEN $4 THEN NOW() END)`
+			if _, err := pool.Exec(ctx, query, userID, email, hashedPassword, tt.emailVerified); err != nil {
+				t.Fatalf("insert user: %v", err)
+			}
+
+			subject := uuid.NewString()
+			if _, err := oidcLogin(t, issuer, provider, pool, identityClaims(subject, email, true)); err != nil {
+				t.Fatalf("login: %v", err)
+			}
+
+			if linked := linkedUser(t, pool, subject); linked != userID {
+				t.Fatalf("identity linked to %s, want the existing account %s", linked, userID)
+			}
+			var hasPassword, verified bool
+			var role string
+			err = pool.QueryRow(ctx, `SELECT password IS NOT NULL, email_verified_at IS NOT NULL, role FROM users WHERE id = $1`, userID).Scan(&hasPassword, &verified, &role)
+			if err != nil {
+				t.Fatalf("load user: %v", err)
+			}
+			if hasPassword != tt.wantPassword || !verified || role != models.RoleVendor {
+				t.Errorf("password=%v verified=%v role=%s, want password=%v verified vendor", hasPassword, verified, role, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestCompleteOIDCLoginRejectsDeactivatedAccount(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	email := uniqueEmail()
+
+	query := `INSERT INTO users (id, email, role, email_verified_at, deleted_at) VALUES ($1, $2, 'user', NOW(), NOW())`
+	if _, err := pool.Exec(context.Background(), query, uuid.New(), email); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	_, err := oidcLogin(t, issuer, issuer.provider(), pool, identityClaims(uuid.NewString(), email, true))
+	if !errors.Is(err, apperrors.ErrUnauthorized) {
+		t.Fatalf("err = %v, want unauthorized", err)
+	}
+}
+
+func TestCompleteOIDCLoginRejectsLockedAccount(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+	userID, email := uuid.New(), uniqueEmail()
+
+	query := `INSERT INTO users (id, email, role, email_verified_at, locked_until) VALUES ($1, $2, 'user', NOW(), NOW() + INTERVAL '10 minutes')`
+	if _, err := pool.Exec(ctx, query, userID, email); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	_, err := oidcLogin(t, issuer, issuer.provider(), pool, identityClaims(uuid.NewString(), email, true))
+	if !errors.Is(err, apperrors.ErrTooManyRequests) {
+		t.Fatalf("err = %v, want too many requests", err)
+	}
+
+	var outcome string
+	query = `SELECT outcome FROM login_attempts WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`
+	if err := pool.QueryRow(ctx, query, userID).Scan(&outcome); err != nil {
+		t.Fatalf("load login attempt: %v", err)
+	}
+	if outcome != LoginLocked {
+		t.Errorf("recorded outcome %q, want %q", outcome, LoginLocked)
+	}
+}
+
+func TestCompleteOIDCLoginRecordsSuccess(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	subject := uuid.NewString()
+
+	if _, err := oidcLogin(t, issuer, issuer.provider(), pool, identityClaims(subject, uniqueEmail(), true)); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	userID := linkedUser(t, pool, subject)
+
+	var outcome string
+	query := `SELECT outcome FROM login_attempts WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`
+	if err := pool.QueryRow(context.Background(), query, userID).Scan(&outcome); err != nil {
+		t.Fatalf("load login attempt: %v", err)
+	}
+	if outcome != LoginSuccess {
+		t.Errorf("recorded outcome %q, want %q", outcome, LoginSuccess)
+	}
+}
+
+func TestCompleteOIDCLoginRejectsBlockedIP(t *testing.T) {
+	pool := testPool(t)
+	issuer := newMockIssuer(t)
+	client := LoginClient{IP: "2001:db8::" + uuid.NewString()[:4], UserAgent: "services-test"}
+	for i := 0; i < ipFailureLimit; i++ {
+		recordLoginAttempt(context.Background(), pool, nil, uniqueEmail(), client, LoginInvalidCredentials)
+	}
+
+	provider := issuer.provider()
+	state, authURL, err := BeginOIDCLogin(provider, "", false, pool)
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	code := issuer.authorize(t, authURL, identityClaims(uuid.NewString(), uniqueEmail(), true))
+	if _, _, err := CompleteOIDCLogin(provider, state, code, client, utils.NewMockEmailSender(), pool); !errors.Is(err, apperrors.ErrTooManyRequests) {
+		t.Fatalf("err = %v, want too many requests", err)
+	}
+}
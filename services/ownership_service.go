@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ResourceKind identifies a table whose rows can be traced back to the user
+// that owns them: businesses.vendor_id, or notifications.user_id.
+type ResourceKind string
+
+const (
+	ResourceBusiness     ResourceKind = "business"
+	ResourceBranch       ResourceKind = "branch"
+	ResourceProduct      ResourceKind = "product"
+	ResourceSubscription ResourceKind = "subscription"
+	ResourcePayment      ResourceKind = "payment"
+	ResourceInvoice      ResourceKind = "invoice"
+	ResourceNotification ResourceKind = "notification"
+)
+
+// ownerQueries skip soft-deleted rows anywhere along the chain, so a
+// resource under a deleted business is not found rather than still owned.
+var ownerQueries = map[ResourceKind]string{
+	ResourceBusiness: `SELECT vendor_id FROM businesses WHERE id = $1 AND deleted_at IS NULL`,
+	ResourceBranch: `
+		SELECT b.vendor_id FROM branches br
+		JOIN businesses b ON br.business_id = b.id
+		WHERE br.id = $1 AND br.deleted_at IS NULL AND b.deleted_at IS NULL`,
+	ResourceProduct: `
+		SELECT b.vendor_id FROM products p
+		JOIN businesses b ON p.business_id = b.id
+		WHERE p.id = $1 AND p.deleted_at IS NULL AND b.deleted_at IS NULL`,
+	ResourceSubscription: `
+		SELECT b.vendor_id FROM subscriptions s
+		JOIN businesses b ON s.business_id = b.id
+		WHERE s.id = $1 AND s.deleted_at IS NULL AND b.deleted_at IS NULL`,
+	ResourcePayment: `
+		SELECT b.vendor_id FROM payments p
+		JOIN subscriptions s ON p.subscription_id = s.id
+		JOIN businesses b ON s.business_id = b.id
+		WHERE p.id = $1 AND p.deleted_at IS NULL AND s.deleted_at IS NULL AND b.deleted_at IS NULL`,
+	ResourceInvoice: `
+		SELECT b.vendor_id FROM invoices i
+		JOIN payments p ON i.payment_id = p.id
+		JOIN subscriptions s ON p.subscription_id = s.id
+		JOIN businesses b ON s.business_id = b.id
+		WHERE i.id = $1 AND i.deleted_at IS NULL AND p.deleted_at IS NULL AND s.deleted_at IS NULL AND b.deleted_at IS NULL`,
+	ResourceNotification: `SELECT user_id FROM notifications WHERE id = $1 AND deleted_at IS NULL`,
+}
+
+// GetResourceOwner returns the user that owns the resource of the given kind,
+// following branches, products, subscriptions, payments and invoices up to
+// the vendor of their business.
+func GetResourceOwner(kind ResourceKind, resourceID uuid.UUID, pool *pgxpool.Pool) (uuid.UUID, error) {
+	query, ok := ownerQueries[kind]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("unknown resource kind %q", kind)
+	}
+
+	var vendorID uuid.UUID
+	err := pool.QueryRow(context.Background(), query, resourceID).Scan(&vendorID)
+	if err != nil {
+		return uuid.Nil, notFoundOr(err, "resource not found")
+	}
+
+	return vendorID, nil
+}
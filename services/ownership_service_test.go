@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/google/uuid"
+)
+
+func TestGetResourceOwnerIgnoresSoftDeletedBusinesses(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+
+	vendorID, businessID, branchID, subscriptionID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	setup := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO users (id, name, email, password, role) VALUES ($1, 'Vendor', $2, 'x', 'vendor')`, []any{vendorID, uniqueEmail()}},
+		{`INSERT INTO businesses (id, vendor_id, name) VALUES ($1, $2, 'Deleted Ltd')`, []any{businessID, vendorID}},
+		{`INSERT INTO branches (id, business_id, location) VALUES ($1, $2, 'Nairobi')`, []any{branchID, businessID}},
+		{`INSERT INTO subscriptions (id, business_id, tier, start_date) VALUES ($1, $2, 'Starter', CURRENT_DATE)`, []any{subscriptionID, businessID}},
+	}
+	for _, step := range setup {
+		if _, err := pool.Exec(ctx, step.query, step.args...); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	resources := map[ResourceKind]uuid.UUID{
+		ResourceBusiness:     businessID,
+		ResourceBranch:       branchID,
+		ResourceSubscription: subscriptionID,
+	}
+	for kind, id := range resources {
+		if owner, err := GetResourceOwner(kind, id, pool); err != nil || owner != vendorID {
+			t.Fatalf("GetResourceOwner(%s) = %v, %v before delete, want the vendor", kind, owner, err)
+		}
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE businesses SET deleted_at = NOW() WHERE id = $1`, businessID); err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	for kind, id := range resources {
+		if _, err := GetResourceOwner(kind, id, pool); !errors.Is(err, apperrors.ErrNotFound) {
+			t.Errorf("GetResourceOwner(%s) error = %v after the business was deleted, want not found", kind, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	PasswordResetTTL = 30 * time.Minute
+	// passwordResetInterval is the minimum time between two reset messages
+	// to the same account.
+	passwordResetInterval = time.Minute
+)
+
+// RequestPasswordReset sends a reset token to the account registered with
+// destination, an email address or phone number depending on channel. The
+// request is processed in the background and success is reported whether or
+// not such an account exists, so neither the response nor its timing reveals
+// accounts; failures are only logged.
+func RequestPasswordReset(channel, destination string, sms utils.SMSSender, mail utils.EmailSender, pool *pgxpool.Pool) error {
+	runInBackground(func() {
+		if err := sendPasswordReset(channel, destination, sms, mail, pool); err != nil {
+			slog.Error("failed to send password reset", slog.String("password_reset.channel", channel), logging.Err(err))
+		}
+	})
+	return nil
+}
+
+// sendPasswordReset issues a token and delivers it once the token is stored,
+// so the user row is not locked while the message is sent.
+func sendPasswordReset(channel, destination string, sms utils.SMSSender, mail utils.EmailSender, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	var token string
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var userID uuid.UUID
+		query := `SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL FOR UPDATE`
+		if channel == VerificationPhone {
+			query = `SELECT id FROM users WHERE phone_number = $1 AND deleted_at IS NULL FOR UPDATE`
+		}
+		err := tx.QueryRow(ctx, query, destination).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var recent bool
+		query = `SELECT EXISTS (SELECT 1 FROM password_reset_tokens WHERE user_id = $1 AND created_at > $2)`
+		if err := tx.QueryRow(ctx, query, userID, time.Now().Add(-passwordResetInterval)).Scan(&recent); err != nil {
+			return err
+		}
+		if recent {
+			return nil
+		}
+
+		newToken, err := randomToken()
+		if err != nil {
+			return err
+		}
+		query = `INSERT INTO password_reset_tokens (id, user_id, token_hash, channel, expires_at) VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.Exec(ctx, query, uuid.New(), userID, hashRefreshToken(newToken), channel, time.Now().Add(PasswordResetTTL))
+		if err != nil {
+			return err
+		}
+		token = newToken
+		return nil
+	})
+	if err != nil || token == "" {
+		return err
+	}
+
+	err = sendMessage(channel, destination, "Reset your password", passwordResetMessage(token), sms, mail)
+	if err != nil {
+		// Drop the undelivered token so the user can ask again straight away.
+		if _, deleteErr := pool.Exec(ctx, `DELETE FROM password_reset_tokens WHERE token_hash = $1`, hashRefreshToken(token)); deleteErr != nil {
+			slog.Error("failed to remove undelivered password reset token", logging.Err(deleteErr))
+		}
+	}
+	return err
+}
+
+// passwordResetMessage links to PASSWORD_RESET_URL when it is set, otherwise
+// the token is sent on its own for the client to submit.
+func passwordResetMessage(token string) string {
+	minutes := int(PasswordResetTTL.Minutes())
+	if resetURL := os.Getenv("PASSWORD_RESET_URL"); resetURL != "" {
+		return fmt.Sprintf("Reset your MONOS password at %s?token=%s. The link expires in %d minutes.", resetURL, token, minutes)
+	}
+	return fmt.Sprintf("Your MONOS password reset token is %s. It expires in %d minutes.", token, minutes)
+}
+
+// ResetPassword sets a new password using a reset token. Every session of
+// the user is revoked, as are any other reset tokens still outstanding.
+func ResetPassword(token, newPassword string, pool *pgxpool.Pool) error {
+	if !isValidPassword(newPassword) {
+		return apperrors.Validation(passwordRules)
+	}
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	ctx := context.Background()
+	var rejection error
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var tokenID, userID uuid.UUID
+		var expiresAt time.Time
+		var usedAt *time.Time
+		query := `SELECT id, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, hashRefreshToken(token)).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			rejection = apperrors.Unauthorized("invalid reset token")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if usedAt != nil || time.Now().After(expiresAt) {
+			rejection = apperrors.Unauthorized("reset token has expired, please request a new one")
+			return nil
+		}
+
+		// Proving ownership of the address also lifts a lockout.
+		query = `UPDATE users SET password = $2, failed_login_count = 0, locked_until = NULL WHERE id = $1 AND deleted_at IS NULL`
+		cmdTag, err := tx.Exec(ctx, query, userID, hashedPassword)
+		if err != nil {
+			return err
+		}
+		if cmdTag.RowsAffected() == 0 {
+			rejection = apperrors.Unauthorized("account is deactivated")
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+		if err != nil {
+			return err
+		}
+		return revokeUserTokens(ctx, tx, userID)
+	})
+	if err != nil {
+		return err
+	}
+	return rejection
+}
+
+// ChangePassword replaces the password of the signed-in user after checking
+// the current one. All of the user's sessions are revoked and a new session
+// is returned for the caller.
+func ChangePassword(claims *models.Claims, currentPassword, newPassword string, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	if !isValidPassword(newPassword) {
+		return nil, apperrors.Validation(passwordRules)
+	}
+	if newPassword == currentPassword {
+		return nil, apperrors.Validation("new password must differ from the current password")
+	}
+
+	ctx := context.Background()
+	var tokens *models.TokenPair
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var hashedPassword, email, phoneNumber *string
+		var role string
+		query := `SELECT password, email, phone_number, role FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, claims.UserID).Scan(&hashedPassword, &email, &phoneNumber, &role); err != nil {
+			return notFoundOr(err, "user not found")
+		}
+		if hashedPassword == nil {
+			return apperrors.Validation("account has no password, use the forgot password flow to set one")
+		}
+		if err := CheckPassword(*hashedPassword, currentPassword); err != nil {
+			return apperrors.Forbidden("current password is incorrect")
+		}
+
+		newHash, err := HashPassword(newPassword)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %v", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1`, claims.UserID, newHash); err != nil {
+			return err
+		}
+		if err := revokeUserTokens(ctx, tx, claims.UserID); err != nil {
+			return err
+		}
+
+		tokens, err = issueTokens(ctx, tx, uuid.New(), claims.UserID, tokenSubject(email, phoneNumber), role, claims.MFA)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
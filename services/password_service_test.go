@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/utils"
+)
+
+// gatedSMSSender blocks every message until release is closed and records
+// what was sent.
+type gatedSMSSender struct {
+	release chan struct{}
+	sent    chan string
+	err     error
+}
+
+func (s *gatedSMSSender) SendSMS(phoneNumber, message string) error {
+	<-s.release
+	s.sent <- phoneNumber
+	return s.err
+}
+
+func uniquePhoneNumber() string {
+	return fmt.Sprintf("+2547%08d", rand.Intn(100000000))
+}
+
+func TestRequestPasswordResetDoesNotWaitForDelivery(t *testing.T) {
+	pool := testPool(t)
+	phoneNumber := uniquePhoneNumber()
+	if _, err := RegisterUserByPhoneNumber("Reset User", phoneNumber, "Passw0rd!", "", utils.NewMockSMSSender(), pool); err != nil {
+		t.Fatalf("RegisterUserByPhoneNumber: %v", err)
+	}
+
+	sms := &gatedSMSSender{release: make(chan struct{}), sent: make(chan string, 2)}
+	for _, destination := range []string{phoneNumber, uniquePhoneNumber()} {
+		returned := make(chan error, 1)
+		go func() {
+			returned <- RequestPasswordReset(VerificationPhone, destination, sms, utils.NewMockEmailSender(), pool)
+		}()
+		select {
+		case err := <-returned:
+			if err != nil {
+				t.Fatalf("RequestPasswordReset(%s): %v", destination, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("RequestPasswordReset(%s) waited for the message to be delivered", destination)
+		}
+	}
+
+	close(sms.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForBackgroundTasks(ctx); err != nil {
+		t.Fatalf("WaitForBackgroundTasks: %v", err)
+	}
+	close(sms.sent)
+
+	var sent []string
+	for destination := range sms.sent {
+		sent = append(sent, destination)
+	}
+	if len(sent) != 1 || sent[0] != phoneNumber {
+		t.Fatalf("sent reset messages to %v, want only the registered %s", sent, phoneNumber)
+	}
+}
+
+func TestRequestPasswordResetDropsUndeliveredToken(t *testing.T) {
+	pool := testPool(t)
+	phoneNumber := uniquePhoneNumber()
+	if _, err := RegisterUserByPhoneNumber("Reset User", phoneNumber, "Passw0rd!", "", utils.NewMockSMSSender(), pool); err != nil {
+		t.Fatalf("RegisterUserByPhoneNumber: %v", err)
+	}
+
+	failing := &gatedSMSSender{release: make(chan struct{}), sent: make(chan string, 1), err: errors.New("gateway down")}
+	close(failing.release)
+	RequestPasswordReset(VerificationPhone, phoneNumber, failing, utils.NewMockEmailSender(), pool)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitForBackgroundTasks(ctx); err != nil {
+		t.Fatalf("WaitForBackgroundTasks: %v", err)
+	}
+
+	var tokens int
+	query := `SELECT COUNT(*) FROM password_reset_tokens t JOIN users u ON u.id = t.user_id WHERE u.phone_number = $1`
+	if err := pool.QueryRow(ctx, query, phoneNumber).Scan(&tokens); err != nil {
+		t.Fatalf("count tokens: %v", err)
+	}
+	if tokens != 0 {
+		t.Fatalf("%d reset tokens left after failed delivery, want 0 so the user can retry", tokens)
+	}
+}
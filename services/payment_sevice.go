@@ -2,12 +2,16 @@ package services
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/Bradkibs/MONOS-challenge/utils"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -16,27 +20,27 @@ func AddPayment(payment *models.Payment, pool *pgxpool.Pool) error {
 	var branchCount int
 
 	err := pool.QueryRow(context.Background(), `
-		SELECT status, tier, businessId 
+		SELECT status, tier, business_id 
 		FROM subscriptions WHERE id = $1`, payment.SubscriptionID).
 		Scan(&subscriptionStatus, &tier, &businessID)
 	if err != nil {
-		return errors.New("subscription does not exist")
+		return notFoundOr(err, "subscription does not exist")
 	}
 	if subscriptionStatus != "active" {
-		return errors.New("cannot add payment to an inactive subscription")
+		return apperrors.Conflict("cannot add payment to an inactive subscription")
 	}
 
 	err = pool.QueryRow(context.Background(), `
-		SELECT COUNT(*) FROM branches WHERE businessId = $1`, businessID).
+		SELECT COUNT(*) FROM branches WHERE business_id = $1 AND deleted_at IS NULL`, businessID).
 		Scan(&branchCount)
 	if err != nil {
-		return errors.New("could not fetch branch count")
+		return fmt.Errorf("could not fetch branch count: %w", err)
 	}
 
 	basePrices := map[string]float64{"Starter": 1.0, "Pro": 3.0, "Enterprise": 5.0}
 	basePrice, exists := basePrices[tier]
 	if !exists {
-		return errors.New("invalid subscription tier")
+		return apperrors.Validation("invalid subscription tier")
 	}
 
 	expectedAmount := basePrice
@@ -50,18 +54,18 @@ func AddPayment(payment *models.Payment, pool *pgxpool.Pool) error {
 	}
 
 	_, err = pool.Exec(context.Background(), `
-		INSERT INTO payments (id, subscriptionId, amount, date, status) 
+		INSERT INTO payments (id, subscription_id, amount, date, status) 
 		VALUES ($1, $2, $3, $4, $5)`,
 		payment.ID, payment.SubscriptionID, payment.Amount, payment.Date, payment.Status)
 	if err != nil {
-		return errors.New("failed to add payment to the database")
+		return fmt.Errorf("failed to add payment to the database: %w", err)
 	}
 
 	return nil
 }
 func GetAllPayments(pool *pgxpool.Pool) ([]models.Payment, error) {
 	rows, err := pool.Query(context.Background(), `
-		SELECT id, subscriptionId, amount, date, status, deleted_at 
+		SELECT id, subscription_id, amount, date, status, deleted_at 
 		FROM payments
 		WHERE deleted_at IS NULL`)
 	if err != nil {
@@ -95,17 +99,17 @@ func GetAllPayments(pool *pgxpool.Pool) ([]models.Payment, error) {
 func GetPaymentByID(paymentID uuid.UUID, pool *pgxpool.Pool) (*models.Payment, error) {
 	var payment models.Payment
 	err := pool.QueryRow(context.Background(), `
-		SELECT id, subscriptionId, amount, date, status FROM payments WHERE id = $1`, paymentID).
+		SELECT id, subscription_id, amount, date, status FROM payments WHERE id = $1 AND deleted_at IS NULL`, paymentID).
 		Scan(&payment.ID, &payment.SubscriptionID, &payment.Amount, &payment.Date, &payment.Status)
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return nil, notFoundOr(err, "payment not found")
 	}
 	return &payment, nil
 }
 
 func GetPaymentsBySubscriptionID(subscriptionID uuid.UUID, pool *pgxpool.Pool) ([]models.Payment, error) {
 	rows, err := pool.Query(context.Background(), `
-		SELECT id, subscriptionId, amount, date, status FROM payments WHERE subscriptionId = $1`, subscriptionID)
+		SELECT id, subscription_id, amount, date, status FROM payments WHERE subscription_id = $1 AND deleted_at IS NULL`, subscriptionID)
 	if err != nil {
 		return nil, err
 	}
@@ -125,40 +129,44 @@ func GetPaymentsBySubscriptionID(subscriptionID uuid.UUID, pool *pgxpool.Pool) (
 
 func UpdatePayment(payment *models.Payment, pool *pgxpool.Pool) error {
 	cmdTag, err := pool.Exec(context.Background(), `
-		UPDATE payments SET amount = $2, date = $3, status = $4 WHERE id = $1`,
+		UPDATE payments SET amount = $2, date = $3, status = $4 WHERE id = $1 AND deleted_at IS NULL`,
 		payment.ID, payment.Amount, payment.Date, payment.Status)
 	if err != nil {
 		return err
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("payment not found")
+		return apperrors.NotFound("payment not found")
 	}
 	return nil
 }
 
 func DeletePayment(paymentID uuid.UUID, pool *pgxpool.Pool) error {
-	query := `UPDATE payments SET deleted_at = NOW() WHERE id = $1`
+	query := `UPDATE payments SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
 	cmdTag, err := pool.Exec(context.Background(), query, paymentID)
 	if err != nil {
 		return fmt.Errorf("failed to delete payment: %w", err)
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows were deleted, payment not found")
+		return apperrors.NotFound("no rows were deleted, payment not found")
 	}
 	return nil
 }
 
 func HandleOverduePayment(subscriptionID uuid.UUID, pool *pgxpool.Pool) error {
-	var endDate time.Time
+	var endDate *time.Time
 	var status string
 	err := pool.QueryRow(context.Background(), `
-		SELECT endDate, status FROM subscriptions WHERE id = $1`, subscriptionID).
+		SELECT end_date, status FROM subscriptions WHERE id = $1`, subscriptionID).
 		Scan(&endDate, &status)
-	if err != nil || status != "active" {
-		return errors.New("invalid or inactive subscription")
+	if err != nil {
+		return notFoundOr(err, "subscription not found")
+	}
+	if status != "active" {
+		return apperrors.Conflict("subscription is not active")
 	}
 
-	if time.Now().After(endDate.Add(7 * 24 * time.Hour)) {
+	// Subscriptions without an end date never fall overdue.
+	if endDate != nil && time.Now().After(endDate.Add(7*24*time.Hour)) {
 		_, err := pool.Exec(context.Background(), `
 			UPDATE subscriptions SET status = 'suspended' WHERE id = $1`, subscriptionID)
 		if err != nil {
@@ -172,10 +180,13 @@ func HandlePartialPayment(paymentID uuid.UUID, pool *pgxpool.Pool) error {
 	var amount float64
 	var status string
 	err := pool.QueryRow(context.Background(), `
-		SELECT amount, status FROM payments WHERE id = $1`, paymentID).
+		SELECT amount, status FROM payments WHERE id = $1 AND deleted_at IS NULL`, paymentID).
 		Scan(&amount, &status)
-	if err != nil || status != "partial" {
-		return errors.New("invalid payment or not partial")
+	if err != nil {
+		return notFoundOr(err, "payment not found")
+	}
+	if status != "partial" {
+		return apperrors.Conflict("payment is not partial")
 	}
 
 	_, err = pool.Exec(context.Background(), `
@@ -183,26 +194,38 @@ func HandlePartialPayment(paymentID uuid.UUID, pool *pgxpool.Pool) error {
 	if err != nil {
 		return err
 	}
-	return errors.New("partial payment rejected, please retry with sufficient funds")
+	return apperrors.PaymentDeclined("partial payment rejected, please retry with sufficient funds", nil)
 }
 
-func ProcessPayment(payment *models.Payment, pool *pgxpool.Pool, paymentMethod string, stripeService utils.StripeService, mpesaService utils.MpesaService) error {
+// ProcessPayment charges the payment through the gateway of the requested
+// method and records it. M-Pesa pushes go to the validated phone number and
+// are paid to the MPESA_SHORTCODE paybill.
+func ProcessPayment(payment *models.Payment, pool *pgxpool.Pool, input *models.ProcessPaymentRequest, stripeService utils.StripeService, mpesaService utils.MpesaService) error {
+	paymentMethod := input.PaymentMethod
 	if paymentMethod == "credit_card" {
+		description := input.Description
+		if description == "" {
+			description = "Payment description"
+		}
 		// Process payment via Stripe
-		chargeID, err := stripeService.Charge(payment.Amount, "USD", "Payment description")
+		chargeID, err := stripeService.Charge(payment.Amount, "USD", description)
 		if err != nil {
-			return fmt.Errorf("failed to process credit card payment: %w", err)
+			return apperrors.PaymentDeclined("failed to process credit card payment", err)
 		}
-		fmt.Printf("Stripe charge successful, Charge ID: %s\n", chargeID)
+		slog.Info("stripe charge successful", slog.String("payment.gateway", "stripe"), slog.String("transaction.id", chargeID))
 	} else if paymentMethod == "mpesa" {
+		phoneNumber, ok := utils.NormalizeMSISDN(input.PhoneNumber)
+		if !ok {
+			return apperrors.Validation("invalid M-Pesa phone number")
+		}
 		// Process payment via M-Pesa Daraja API
-		transactionID, err := mpesaService.ProcessExpressPayment(payment.Amount, "254712345678", "Business Shortcode")
+		transactionID, err := mpesaService.ProcessExpressPayment(payment.Amount, phoneNumber, mpesaShortcode())
 		if err != nil {
-			return fmt.Errorf("failed to process mobile money payment: %w", err)
+			return apperrors.PaymentDeclined("failed to process mobile money payment", err)
 		}
-		fmt.Printf("M-Pesa payment successful, Transaction ID: %s\n", transactionID)
+		slog.Info("m-pesa payment successful", slog.String("payment.gateway", "mpesa"), slog.String("transaction.id", transactionID))
 	} else {
-		return errors.New("unsupported payment method")
+		return apperrors.Validation("unsupported payment method")
 	}
 
 	// Assign values to the payment model
@@ -217,3 +240,26 @@ func ProcessPayment(payment *models.Payment, pool *pgxpool.Pool, paymentMethod s
 
 	return nil
 }
+
+// SendPaymentConfirmation emails a receipt for payment in the background.
+// Accounts signed in with a phone number have no address to send it to.
+func SendPaymentConfirmation(to string, payment *models.Payment, mail utils.EmailSender) {
+	if !strings.Contains(to, "@") {
+		return
+	}
+	runInBackground(func() {
+		message := fmt.Sprintf("Your payment of %.2f has been successfully processed.", payment.Amount)
+		if err := mail.SendEmail(to, "Payment Processed", message); err != nil {
+			slog.Warn("failed to send payment confirmation", slog.String("payment.id", payment.ID.String()), logging.Err(err))
+		}
+	})
+}
+
+// mpesaShortcode is the paybill M-Pesa payments are made to, the Daraja
+// sandbox shortcode unless MPESA_SHORTCODE is set.
+func mpesaShortcode() string {
+	if shortcode := os.Getenv("MPESA_SHORTCODE"); shortcode != "" {
+		return shortcode
+	}
+	return "174379"
+}
@@ -0,0 +1,25 @@
+package services
+
+import "sync"
+
+var (
+	changeListenersMu sync.RWMutex
+	changeListeners   []func(kind ResourceKind)
+)
+
+// OnResourceChange registers fn to be called after a service successfully
+// creates, updates or deletes a resource of some kind. It is used to keep
+// derived state such as response caches in sync with the database.
+func OnResourceChange(fn func(kind ResourceKind)) {
+	changeListenersMu.Lock()
+	defer changeListenersMu.Unlock()
+	changeListeners = append(changeListeners, fn)
+}
+
+func notifyResourceChange(kind ResourceKind) {
+	changeListenersMu.RLock()
+	defer changeListenersMu.RUnlock()
+	for _, fn := range changeListeners {
+		fn(kind)
+	}
+}
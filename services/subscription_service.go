@@ -2,13 +2,16 @@ package services
 
 import (
 	"context"
-	"errors"
 	"time"
 
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
 	"github.com/Bradkibs/MONOS-challenge/models"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// tierRanks orders the subscription tiers from cheapest to most expensive.
+var tierRanks = map[string]int{"Starter": 1, "Pro": 2, "Enterprise": 3}
+
 func CalculateSubscriptionCost(subscriptionTier string, branchCount int) (float64, error) {
 	var basePrice float64
 
@@ -20,28 +23,28 @@ func CalculateSubscriptionCost(subscriptionTier string, branchCount int) (float6
 	case "Enterprise":
 		basePrice = 5.0
 	default:
-		return 0.0, errors.New("invalid subscription tier")
+		return 0.0, apperrors.Validation("invalid subscription tier")
 	}
 	totalCost := basePrice + float64(branchCount)*1.0
 	return totalCost, nil
 }
 
 func CancelSubscription(subscriptionID string, pool *pgxpool.Pool) error {
-	query := `SELECT startDate, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	query := `SELECT start_date, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
 	var startDate time.Time
 	var status string
 
 	err := pool.QueryRow(context.Background(), query, subscriptionID).Scan(&startDate, &status)
 	if err != nil {
-		return err
+		return notFoundOr(err, "subscription not found")
 	}
 
 	if status != "active" {
-		return errors.New("subscription is not active, cancellation not possible")
+		return apperrors.Conflict("subscription is not active, cancellation not possible")
 	}
 
 	if time.Since(startDate) > 7*24*time.Hour {
-		return errors.New("refund not allowed after 1 week of subscription start")
+		return apperrors.Conflict("refund not allowed after 1 week of subscription start")
 	}
 
 	updateQuery := `UPDATE subscriptions SET status = 'canceled', deleted_at = NOW() WHERE id = $1`
@@ -50,17 +53,44 @@ func CancelSubscription(subscriptionID string, pool *pgxpool.Pool) error {
 }
 
 func DowngradeSubscription(subscriptionID, newTier string, pool *pgxpool.Pool) error {
-	query := `SELECT s.businessId, COUNT(p.id) FROM subscriptions s LEFT JOIN products p ON s.businessId = p.businessId WHERE s.id = $1 AND s.deleted_at IS NULL GROUP BY s.businessId`
+	query := `SELECT s.business_id, COUNT(p.id) FROM subscriptions s LEFT JOIN products p ON s.business_id = p.business_id WHERE s.id = $1 AND s.deleted_at IS NULL GROUP BY s.business_id`
 	var businessID string
 	var productCount int
 
 	err := pool.QueryRow(context.Background(), query, subscriptionID).Scan(&businessID, &productCount)
 	if err != nil {
-		return err
+		return notFoundOr(err, "subscription not found")
 	}
 
 	if (newTier == "Starter" && productCount > 10) || (newTier == "Pro" && productCount > 100) {
-		return errors.New("reduce product count before downgrading")
+		return apperrors.Conflict("reduce product count before downgrading")
+	}
+
+	updateQuery := `UPDATE subscriptions SET tier = $2 WHERE id = $1 AND deleted_at IS NULL`
+	_, err = pool.Exec(context.Background(), updateQuery, subscriptionID, newTier)
+	return err
+}
+
+func UpgradeSubscription(subscriptionID, newTier string, pool *pgxpool.Pool) error {
+	newRank, ok := tierRanks[newTier]
+	if !ok {
+		return apperrors.Validation("invalid subscription tier")
+	}
+
+	query := `SELECT tier, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	var currentTier, status string
+
+	err := pool.QueryRow(context.Background(), query, subscriptionID).Scan(&currentTier, &status)
+	if err != nil {
+		return notFoundOr(err, "subscription not found")
+	}
+
+	if status != "active" {
+		return apperrors.Conflict("subscription is not active, upgrade not possible")
+	}
+
+	if newRank <= tierRanks[currentTier] {
+		return apperrors.Validation("new tier must be higher than the current tier")
 	}
 
 	updateQuery := `UPDATE subscriptions SET tier = $2 WHERE id = $1 AND deleted_at IS NULL`
@@ -69,37 +99,47 @@ func DowngradeSubscription(subscriptionID, newTier string, pool *pgxpool.Pool) e
 }
 
 func HandleSubscriptionOverlap(currentSubscriptionID string, newSubscription *models.Subscription, pool *pgxpool.Pool) error {
-	query := `SELECT endDate, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
-	var currentEndDate time.Time
+	query := `SELECT end_date, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	var currentEndDate *time.Time
 	var currentStatus string
 
 	err := pool.QueryRow(context.Background(), query, currentSubscriptionID).Scan(&currentEndDate, &currentStatus)
 	if err != nil {
-		return err
+		return notFoundOr(err, "subscription not found")
 	}
 
 	if currentStatus != "active" {
-		return errors.New("current subscription is not active")
+		return apperrors.Conflict("current subscription is not active")
+	}
+
+	// A subscription without an end date already covers any new one.
+	if currentEndDate == nil {
+		return apperrors.Conflict("current subscription does not expire")
 	}
 
-	if newSubscription.StartDate.Before(currentEndDate) {
-		extendedEndDate := currentEndDate.Add(newSubscription.EndDate.Sub(newSubscription.StartDate))
-		updateQuery := `UPDATE subscriptions SET endDate = $2 WHERE id = $1 AND deleted_at IS NULL`
+	if newSubscription.StartDate.Before(*currentEndDate) {
+		// An open-ended new subscription leaves the current one open-ended.
+		var extendedEndDate *time.Time
+		if newSubscription.EndDate != nil {
+			extended := currentEndDate.Add(newSubscription.EndDate.Sub(newSubscription.StartDate))
+			extendedEndDate = &extended
+		}
+		updateQuery := `UPDATE subscriptions SET end_date = $2 WHERE id = $1 AND deleted_at IS NULL`
 		_, err = pool.Exec(context.Background(), updateQuery, currentSubscriptionID, extendedEndDate)
 		return err
 	}
 
-	return errors.New("no overlap detected")
+	return apperrors.Conflict("no overlap detected")
 }
 
 func CreateSubscription(subscription *models.Subscription, pool *pgxpool.Pool) error {
-	query := `INSERT INTO subscriptions (id, businessId, tier, startDate, endDate, status) VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO subscriptions (id, business_id, tier, start_date, end_date, status) VALUES ($1, $2, $3, $4, $5, $6)`
 	_, err := pool.Exec(context.Background(), query, subscription.ID, subscription.BusinessID, subscription.Tier, subscription.StartDate, subscription.EndDate, subscription.Status)
 	return err
 }
 
 func GetSubscription(subscriptionID string, pool *pgxpool.Pool) (*models.Subscription, error) {
-	query := `SELECT id, businessId, tier, startDate, endDate, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	query := `SELECT id, business_id, tier, start_date, end_date, status FROM subscriptions WHERE id = $1 AND deleted_at IS NULL`
 	var subscription models.Subscription
 	err := pool.QueryRow(context.Background(), query, subscriptionID).Scan(
 		&subscription.ID,
@@ -110,19 +150,19 @@ func GetSubscription(subscriptionID string, pool *pgxpool.Pool) (*models.Subscri
 		&subscription.Status,
 	)
 	if err != nil {
-		return nil, errors.New("subscription not found")
+		return nil, notFoundOr(err, "subscription not found")
 	}
 	return &subscription, nil
 }
 
 func UpdateSubscription(subscription *models.Subscription, pool *pgxpool.Pool) error {
-	query := `UPDATE subscriptions SET tier = $2, startDate = $3, endDate = $4, status = $5 WHERE id = $1 AND deleted_at IS NULL`
+	query := `UPDATE subscriptions SET tier = $2, start_date = $3, end_date = $4, status = $5 WHERE id = $1 AND deleted_at IS NULL`
 	cmdTag, err := pool.Exec(context.Background(), query, subscription.ID, subscription.Tier, subscription.StartDate, subscription.EndDate, subscription.Status)
 	if err != nil {
 		return err
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows updated")
+		return apperrors.NotFound("no rows updated, subscription not found")
 	}
 	return nil
 }
@@ -134,7 +174,7 @@ func DeleteSubscription(subscriptionID string, pool *pgxpool.Pool) error {
 		return err
 	}
 	if cmdTag.RowsAffected() == 0 {
-		return errors.New("no rows deleted")
+		return apperrors.NotFound("no rows deleted, subscription not found")
 	}
 	return nil
 }
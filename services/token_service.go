@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// AccessTokenTTL is kept short because access tokens are only checked
+	// against the revocation list, not re-read from the users table.
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// IssueTokens starts a new session for the user: a fresh access token and
+// the first refresh token of a new token family. The session is not marked
+// as established with a second factor.
+func IssueTokens(userID uuid.UUID, subject, role string, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	return issueTokens(context.Background(), pool, uuid.New(), userID, subject, role, false)
+}
+
+func issueTokens(ctx context.Context, db execer, familyID, userID uuid.UUID, subject, role string, mfa bool) (*models.TokenPair, error) {
+	accessToken, claims, err := newAccessToken(userID, subject, role, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().Add(RefreshTokenTTL)
+
+	query := `INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, access_token_id, access_expires_at, expires_at, mfa) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = db.Exec(ctx, query, uuid.New(), familyID, userID, hashRefreshToken(refreshToken), claims.ID, claims.ExpiresAt, refreshExpiresAt, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        claims.ExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new pair in the same family.
+// Presenting a refresh token that was already exchanged means it leaked, so
+// the whole family is revoked, including its unexpired access tokens, and
+// the user has to sign in again.
+func RefreshTokens(refreshToken string, pool *pgxpool.Pool) (*models.TokenPair, error) {
+	ctx := context.Background()
+
+	var pair *models.TokenPair
+	var rejection error
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var familyID, userID uuid.UUID
+		var expiresAt time.Time
+		var usedAt, revokedAt *time.Time
+		var mfa bool
+		query := `SELECT family_id, user_id, expires_at, used_at, revoked_at, mfa FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, hashRefreshToken(refreshToken)).Scan(&familyID, &userID, &expiresAt, &usedAt, &revokedAt, &mfa)
+		if errors.Is(err, pgx.ErrNoRows) {
+			rejection = apperrors.Unauthorized("invalid refresh token")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case revokedAt != nil:
+			rejection = apperrors.Unauthorized("refresh token has been revoked")
+			return nil
+		case usedAt != nil:
+			rejection = apperrors.Unauthorized("refresh token reuse detected, please sign in again")
+			return revokeFamily(ctx, tx, familyID)
+		case time.Now().After(expiresAt):
+			rejection = apperrors.Unauthorized("refresh token has expired")
+			return nil
+		}
+
+		var email, phoneNumber *string
+		var role string
+		var deletedAt *time.Time
+		query = `SELECT email, phone_number, role, deleted_at FROM users WHERE id = $1`
+		err = tx.QueryRow(ctx, query, userID).Scan(&email, &phoneNumber, &role, &deletedAt)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err != nil || deletedAt != nil {
+			rejection = apperrors.Unauthorized("account is deactivated")
+			return revokeFamily(ctx, tx, familyID)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, hashRefreshToken(refreshToken)); err != nil {
+			return err
+		}
+
+		pair, err = issueTokens(ctx, tx, familyID, userID, tokenSubject(email, phoneNumber), role, mfa)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rejection != nil {
+		return nil, rejection
+	}
+	return pair, nil
+}
+
+// Logout revokes the presented access token and the session it belongs to.
+// The session is found through refreshToken when given, otherwise through
+// the access token it was issued with. Expired revocation entries and
+// refresh tokens are purged on the way.
+func Logout(claims *models.Claims, refreshToken string, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var familyID uuid.UUID
+		var err error
+		if refreshToken != "" {
+			query := `SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2`
+			err = tx.QueryRow(ctx, query, hashRefreshToken(refreshToken), claims.UserID).Scan(&familyID)
+		} else {
+			query := `SELECT family_id FROM refresh_tokens WHERE access_token_id = $1 AND user_id = $2`
+			err = tx.QueryRow(ctx, query, claims.ID, claims.UserID).Scan(&familyID)
+		}
+		switch {
+		case err == nil:
+			if err := revokeFamily(ctx, tx, familyID); err != nil {
+				return err
+			}
+		case !errors.Is(err, pgx.ErrNoRows):
+			return err
+		}
+
+		if err := revokeAccessToken(ctx, tx, claims.ID, claims.ExpiresAt); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < NOW()`)
+		return err
+	})
+}
+
+// IsTokenRevoked reports whether the access token with the given jti has
+// been revoked.
+func IsTokenRevoked(jti uuid.UUID, pool *pgxpool.Pool) (bool, error) {
+	var revoked bool
+	err := pool.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// revokeFamily revokes every refresh token of a family together with the
+// access tokens issued alongside them that have not expired yet.
+func revokeFamily(ctx context.Context, tx pgx.Tx, familyID uuid.UUID) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_token_id, access_expires_at FROM refresh_tokens
+		WHERE family_id = $1 AND access_expires_at > NOW()
+		ON CONFLICT (jti) DO NOTHING`
+	if _, err := tx.Exec(ctx, query, familyID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	return err
+}
+
+// revokeUserTokens ends every session of the user.
+func revokeUserTokens(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expires_at)
+		SELECT access_token_id, access_expires_at FROM refresh_tokens
+		WHERE user_id = $1 AND access_expires_at > NOW()
+		ON CONFLICT (jti) DO NOTHING`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+func revokeAccessToken(ctx context.Context, db execer, jti uuid.UUID, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+	_, err := db.Exec(ctx, query, jti, expiresAt)
+	return err
+}
+
+// newRefreshToken returns an opaque random token. Only its SHA-256 digest is
+// stored, so a database leak does not hand out usable tokens.
+func newRefreshToken() (string, error) {
+	return randomToken()
+}
+
+// randomToken returns 256 random bits, base64url encoded.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// tokenSubject is the identifier placed in the token's email claim: the
+// email address when the account has one, otherwise the phone number.
+func tokenSubject(email, phoneNumber *string) string {
+	if email != nil && *email != "" {
+		return *email
+	}
+	if phoneNumber != nil {
+		return *phoneNumber
+	}
+	return ""
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetProfile returns the account of an active user.
+func GetProfile(userID uuid.UUID, pool *pgxpool.Pool) (*models.Profile, error) {
+	query := `
+		SELECT u.id, u.name, u.email, u.phone_number, u.role,
+			u.email_verified_at IS NOT NULL, u.phone_verified_at IS NOT NULL, u.verified,
+			EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.enabled_at IS NOT NULL),
+			u.created_at
+		FROM users u WHERE u.id = $1 AND u.deleted_at IS NULL`
+
+	var profile models.Profile
+	err := pool.QueryRow(context.Background(), query, userID).Scan(&profile.ID, &profile.Name, &profile.Email, &profile.PhoneNumber, &profile.Role,
+		&profile.EmailVerified, &profile.PhoneVerified, &profile.Verified, &profile.MFAEnabled, &profile.CreatedAt)
+	if err != nil {
+		return nil, notFoundOr(err, "user not found")
+	}
+	return &profile, nil
+}
+
+// UpdateProfile changes the fields set in input. A new email address or phone
+// number starts out unverified and a verification code is sent to it.
+func UpdateProfile(userID uuid.UUID, input models.UpdateProfileRequest, sms utils.SMSSender, mail utils.EmailSender, pool *pgxpool.Pool) (*models.Profile, error) {
+	if input.Email != nil && *input.Email == "" {
+		return nil, apperrors.Validation("email cannot be empty")
+	}
+	if input.PhoneNumber != nil && *input.PhoneNumber == "" {
+		return nil, apperrors.Validation("phone number cannot be empty")
+	}
+
+	ctx := context.Background()
+	var changed []string
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var name string
+		var email, phoneNumber *string
+		query := `SELECT name, email, phone_number FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, userID).Scan(&name, &email, &phoneNumber); err != nil {
+			return notFoundOr(err, "user not found")
+		}
+
+		if input.Name != nil && *input.Name != name {
+			if _, err := tx.Exec(ctx, `UPDATE users SET name = $2 WHERE id = $1`, userID, *input.Name); err != nil {
+				return err
+			}
+		}
+		if input.Email != nil && (email == nil || *input.Email != *email) {
+			if err := ensureIdentifierFree(ctx, tx, `SELECT id FROM users WHERE email = $1`, *input.Email, "email"); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `UPDATE users SET email = $2, email_verified_at = NULL WHERE id = $1`, userID, *input.Email); err != nil {
+				return err
+			}
+			changed = append(changed, VerificationEmail)
+		}
+		if input.PhoneNumber != nil && (phoneNumber == nil || *input.PhoneNumber != *phoneNumber) {
+			if err := ensureIdentifierFree(ctx, tx, `SELECT id FROM users WHERE phone_number = $1`, *input.PhoneNumber, "phone number"); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `UPDATE users SET phone_number = $2, phone_verified_at = NULL WHERE id = $1`, userID, *input.PhoneNumber); err != nil {
+				return err
+			}
+			changed = append(changed, VerificationPhone)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range changed {
+		if err := SendVerificationCode(userID, channel, sms, mail, pool); err != nil {
+			slog.Warn("failed to send verification code", slog.String("user.id", userID.String()), logging.Err(err))
+		}
+		message := fmt.Sprintf("The %s on your account was changed. If this was not you, reset your password.", channelName(channel))
+		if err := CreateNotification(pool, &models.Notification{UserID: userID, Type: "Security", Message: message}); err != nil {
+			slog.Error("failed to log notification", slog.String("user.id", userID.String()), logging.Err(err))
+		}
+	}
+
+	return GetProfile(userID, pool)
+}
+
+// ensureIdentifierFree rejects an email address or phone number that belongs
+// to another account, including closed ones that still hold it.
+func ensureIdentifierFree(ctx context.Context, tx pgx.Tx, query, value, field string) error {
+	var existingUserID uuid.UUID
+	err := tx.QueryRow(ctx, query, value).Scan(&existingUserID)
+	if err == nil {
+		return apperrors.Conflict("user with this " + field + " already exists")
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// DeactivateAccount closes the account but keeps its data. Every session is
+// revoked, the user's businesses are hidden and their subscriptions
+// suspended.
+func DeactivateAccount(claims *models.Claims, password string, pool *pgxpool.Pool) error {
+	return closeAccount(claims, password, false, pool)
+}
+
+// DeleteAccount closes the account and erases the user's personal data and
+// credentials. The email address and phone number become free to register
+// again. Billing records are kept; subscriptions are canceled. A deactivated
+// user can no longer sign in to call this; EraseAccount covers them.
+func DeleteAccount(claims *models.Claims, password string, pool *pgxpool.Pool) error {
+	return closeAccount(claims, password, true, pool)
+}
+
+// EraseAccount is DeleteAccount on behalf of an administrator. It also
+// applies to accounts that are already deactivated, so an erasure request
+// that arrives after deactivation can still be honoured.
+func EraseAccount(userID uuid.UUID, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT true FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&exists); err != nil {
+			return notFoundOr(err, "user not found")
+		}
+		return shutDownAccount(ctx, tx, userID, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyResourceChange(ResourceBusiness)
+	return nil
+}
+
+func closeAccount(claims *models.Claims, password string, erase bool, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var hashedPassword *string
+		query := `SELECT password FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+		if err := tx.QueryRow(ctx, query, claims.UserID).Scan(&hashedPassword); err != nil {
+			return notFoundOr(err, "user not found")
+		}
+		// Accounts created through single sign-on have no password; the
+		// signed-in session is the only proof available for them.
+		if hashedPassword != nil {
+			if err := CheckPassword(*hashedPassword, password); err != nil {
+				return apperrors.Forbidden("password is incorrect")
+			}
+		}
+		return shutDownAccount(ctx, tx, claims.UserID, erase)
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyResourceChange(ResourceBusiness)
+	return nil
+}
+
+// shutDownAccount marks the user deleted, revokes their sessions, hides their
+// businesses and stops their subscriptions, erasing personal data if erase
+// is set. The user row must already be locked.
+func shutDownAccount(ctx context.Context, tx pgx.Tx, userID uuid.UUID, erase bool) error {
+	query := `UPDATE users SET deleted_at = COALESCE(deleted_at, NOW()) WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+	if err := revokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	// Erasing a deactivated account also cancels what deactivation suspended.
+	subscriptionStatus, subscriptionDeletedAt, stoppable := "suspended", "deleted_at", "'active'"
+	if erase {
+		subscriptionStatus, subscriptionDeletedAt, stoppable = "canceled", "COALESCE(deleted_at, NOW())", "'active', 'suspended'"
+	}
+	query = `
+		UPDATE subscriptions SET status = $2, deleted_at = ` + subscriptionDeletedAt + `
+		WHERE status IN (` + stoppable + `) AND business_id IN (SELECT id FROM businesses WHERE vendor_id = $1)`
+	if _, err := tx.Exec(ctx, query, userID, subscriptionStatus); err != nil {
+		return err
+	}
+	query = `UPDATE businesses SET deleted_at = NOW() WHERE vendor_id = $1 AND deleted_at IS NULL`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	if erase {
+		return eraseUser(ctx, tx, userID)
+	}
+	return nil
+}
+
+// eraseUser removes personal data and credentials of a closed account. The
+// row itself stays so invoices and payments keep their owner. The email
+// column is replaced by a placeholder because users must keep one of email
+// or phone number.
+func eraseUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	query := `
+		UPDATE users SET
+			name = '', email = id::text || '@deleted.invalid', phone_number = NULL, password = NULL,
+			email_verified_at = NULL, phone_verified_at = NULL, failed_login_count = 0, locked_until = NULL
+		WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM user_mfa WHERE user_id = $1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM mfa_challenges WHERE user_id = $1`,
+		`DELETE FROM user_devices WHERE user_id = $1`,
+		`DELETE FROM verification_codes WHERE user_id = $1`,
+		`DELETE FROM password_reset_tokens WHERE user_id = $1`,
+		`UPDATE login_attempts SET user_id = NULL, identifier = '' WHERE user_id = $1`,
+		`UPDATE notifications SET deleted_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
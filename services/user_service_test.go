@@ -0,0 +1,36 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bradkibs/MONOS-challenge/models"
+	"github.com/google/uuid"
+)
+
+func TestEraseAccountAfterDeactivation(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	claims := &models.Claims{UserID: uuid.New(), Email: uniqueEmail(), Role: models.RoleUser}
+	query := `INSERT INTO users (id, name, email, role, email_verified_at) VALUES ($1, 'Closed User', $2, 'user', NOW())`
+	if _, err := pool.Exec(ctx, query, claims.UserID, claims.Email); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	if err := DeactivateAccount(claims, "", pool); err != nil {
+		t.Fatalf("DeactivateAccount: %v", err)
+	}
+	if err := EraseAccount(claims.UserID, pool); err != nil {
+		t.Fatalf("EraseAccount: %v", err)
+	}
+
+	var name, email string
+	var deleted bool
+	query = `SELECT name, email, deleted_at IS NOT NULL FROM users WHERE id = $1`
+	if err := pool.QueryRow(ctx, query, claims.UserID).Scan(&name, &email, &deleted); err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if name != "" || email == claims.Email || !deleted {
+		t.Errorf("user = %q %q deleted=%v, want personal data erased", name, email, deleted)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/Bradkibs/MONOS-challenge/apperrors"
+	"github.com/Bradkibs/MONOS-challenge/logging"
+	"github.com/Bradkibs/MONOS-challenge/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Verification channels: the account's email address or phone number.
+const (
+	VerificationEmail = "email"
+	VerificationPhone = "phone"
+)
+
+const (
+	VerificationCodeTTL = 10 * time.Minute
+	// verificationMaxAttempts is the number of wrong guesses a code survives.
+	verificationMaxAttempts = 5
+	// A new code can be requested once per verificationResendInterval and at
+	// most verificationMaxSendsPerHour times per hour and channel.
+	verificationResendInterval  = time.Minute
+	verificationMaxSendsPerHour = 5
+)
+
+// SendVerificationCode sends a one-time code to the user's email address or
+// phone number. The code replaces any code sent earlier on that channel. It is
+// stored first and delivered in the background, so neither the user row nor
+// a connection is held while the message goes out; a code that cannot be
+// delivered is deleted so it does not count against the resend limits.
+func SendVerificationCode(userID uuid.UUID, channel string, sms utils.SMSSender, mail utils.EmailSender, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	var issued *issuedCode
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var err error
+		issued, err = createVerificationCode(ctx, tx, userID, channel)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your MONOS verification code is %s. It expires in %d minutes.", issued.code, int(VerificationCodeTTL.Minutes()))
+	runInBackground(func() {
+		if err := sendMessage(channel, issued.destination, "Verify your email address", message, sms, mail); err != nil {
+			slog.Error("failed to send verification code", slog.String("user.id", userID.String()), slog.String("verification.channel", channel), logging.Err(err))
+			if _, err := pool.Exec(ctx, `DELETE FROM verification_codes WHERE id = $1`, issued.id); err != nil {
+				slog.Error("failed to remove undelivered verification code", slog.String("user.id", userID.String()), logging.Err(err))
+			}
+		}
+	})
+	return nil
+}
+
+// issuedCode is a stored verification code waiting to be delivered.
+type issuedCode struct {
+	id          uuid.UUID
+	destination string
+	code        string
+}
+
+// createVerificationCode stores a new code for the user's destination on
+// channel, enforcing the resend limits.
+func createVerificationCode(ctx context.Context, tx pgx.Tx, userID uuid.UUID, channel string) (*issuedCode, error) {
+	// Locking the user serialises concurrent requests so the throttle holds.
+	var destination *string
+	var verifiedAt *time.Time
+	query := `SELECT email, email_verified_at FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	if channel == VerificationPhone {
+		query = `SELECT phone_number, phone_verified_at FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	}
+	if err := tx.QueryRow(ctx, query, userID).Scan(&destination, &verifiedAt); err != nil {
+		return nil, notFoundOr(err, "user not found")
+	}
+	if destination == nil || *destination == "" {
+		return nil, apperrors.Validation("account has no " + channelName(channel))
+	}
+	if verifiedAt != nil {
+		return nil, apperrors.Conflict(channelName(channel) + " is already verified")
+	}
+
+	var sentLastHour int
+	var lastSentAt *time.Time
+	query = `
+		SELECT COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 hour'), MAX(created_at)
+		FROM verification_codes WHERE user_id = $1 AND channel = $2`
+	if err := tx.QueryRow(ctx, query, userID, channel).Scan(&sentLastHour, &lastSentAt); err != nil {
+		return nil, err
+	}
+	if lastSentAt != nil {
+		if wait := time.Until(lastSentAt.Add(verificationResendInterval)); wait > 0 {
+			return nil, apperrors.TooManyRequests(fmt.Sprintf("please wait %d seconds before requesting another code", int(wait.Seconds())+1))
+		}
+	}
+	if sentLastHour >= verificationMaxSendsPerHour {
+		return nil, apperrors.TooManyRequests("too many codes requested, please try again later")
+	}
+
+	code, err := newVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+	codeID := uuid.New()
+	query = `INSERT INTO verification_codes (id, user_id, channel, destination, code_hash, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(ctx, query, codeID, userID, channel, *destination, hashVerificationCode(codeID, code), time.Now().Add(VerificationCodeTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &issuedCode{id: codeID, destination: *destination, code: code}, nil
+}
+
+// VerifyCode checks code against the latest code sent on channel and marks
+// the email address or phone number as verified.
+func VerifyCode(userID uuid.UUID, channel, code string, pool *pgxpool.Pool) error {
+	ctx := context.Background()
+
+	var rejection error
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		var codeID uuid.UUID
+		var destination string
+		var codeHash []byte
+		var attempts int
+		var expiresAt time.Time
+		query := `
+			SELECT id, destination, code_hash, attempts, expires_at FROM verification_codes
+			WHERE user_id = $1 AND channel = $2 AND consumed_at IS NULL
+			ORDER BY created_at DESC LIMIT 1 FOR UPDATE`
+		err := tx.QueryRow(ctx, query, userID, channel).Scan(&codeID, &destination, &codeHash, &attempts, &expiresAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			rejection = apperrors.Validation("no pending verification code, please request a new one")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if attempts >= verificationMaxAttempts || time.Now().After(expiresAt) {
+			rejection = apperrors.Validation("verification code has expired, please request a new one")
+			return nil
+		}
+
+		if !hmac.Equal(codeHash, hashVerificationCode(codeID, code)) {
+			rejection = apperrors.Validation("invalid verification code")
+			_, err := tx.Exec(ctx, `UPDATE verification_codes SET attempts = attempts + 1 WHERE id = $1`, codeID)
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE verification_codes SET consumed_at = NOW() WHERE id = $1`, codeID); err != nil {
+			return err
+		}
+
+		// The code only counts for the address it was sent to.
+		query = `UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email = $2`
+		if channel == VerificationPhone {
+			query = `UPDATE users SET phone_verified_at = NOW() WHERE id = $1 AND phone_number = $2`
+		}
+		cmdTag, err := tx.Exec(ctx, query, userID, destination)
+		if err != nil {
+			return err
+		}
+		if cmdTag.RowsAffected() == 0 {
+			rejection = apperrors.Validation(channelName(channel) + " has changed, please request a new code")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return rejection
+}
+
+// IsUserVerified reports whether the user has verified their email address
+// or phone number.
+func IsUserVerified(userID uuid.UUID, pool *pgxpool.Pool) (bool, error) {
+	var verified bool
+	err := pool.QueryRow(context.Background(), `SELECT verified FROM users WHERE id = $1`, userID).Scan(&verified)
+	if err != nil {
+		return false, notFoundOr(err, "user not found")
+	}
+	return verified, nil
+}
+
+// newVerificationCode returns a random six digit code.
+func newVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashVerificationCode keys the digest with the JWT secret: six digits are
+// too few to survive offline guessing of a plain hash.
+func hashVerificationCode(codeID uuid.UUID, code string) []byte {
+	mac := hmac.New(sha256.New, jwtSecret())
+	mac.Write([]byte(codeID.String() + ":" + code))
+	return mac.Sum(nil)
+}
+
+func channelName(channel string) string {
+	if channel == VerificationPhone {
+		return "phone number"
+	}
+	return "email address"
+}
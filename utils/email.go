@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EmailProviderMock = "mock"
+	EmailProviderSMTP = "smtp"
+)
+
+// smtpTimeout bounds the whole exchange with the mail server, from dialing
+// to QUIT.
+const smtpTimeout = 10 * time.Second
+
+// EmailSender delivers email such as verification codes and security alerts.
+type EmailSender interface {
+	SendEmail(to, subject, message string) error
+}
+
+// MockEmailSender is a mock implementation of EmailSender
+type MockEmailSender struct{}
+
+func (s *MockEmailSender) SendEmail(to, subject, message string) error {
+	// Simulate successful email delivery
+	if to == "" || message == "" {
+		return errors.New("invalid recipient or message")
+	}
+	return nil
+}
+
+func NewMockEmailSender() EmailSender {
+	return &MockEmailSender{}
+}
+
+// SMTPEmailSender sends plain text email through an SMTP relay, upgrading
+// the connection with STARTTLS when the server offers it.
+type SMTPEmailSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// NewSMTPEmailSender returns a sender for the relay at host:port. username
+// may be empty for relays that do not require authentication.
+func NewSMTPEmailSender(host, port, username, password, from string) *SMTPEmailSender {
+	return &SMTPEmailSender{host: host, port: port, username: username, password: password, from: from, timeout: smtpTimeout}
+}
+
+func (s *SMTPEmailSender) SendEmail(to, subject, message string) error {
+	if to == "" || message == "" {
+		return errors.New("invalid recipient or message")
+	}
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("recipient and subject must not contain line breaks")
+	}
+	if err := s.send(to, subject, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTPEmailSender) send(to, subject, message string) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.host, s.port), s.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	body, err := client.Data()
+	if err != nil {
+		return err
+	}
+	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n",
+		s.from, to, subject, time.Now().Format(time.RFC1123Z))
+	if _, err := body.Write([]byte(headers + message)); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// EmailSenderFromEnv configures the sender named by EMAIL_PROVIDER. The smtp
+// provider reads SMTP_HOST, SMTP_PORT (587 by default), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM. An empty EMAIL_PROVIDER selects the mock
+// sender, which delivers nothing.
+func EmailSenderFromEnv() (EmailSender, string, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("EMAIL_PROVIDER")))
+	switch provider {
+	case "", EmailProviderMock:
+		return NewMockEmailSender(), EmailProviderMock, nil
+	case EmailProviderSMTP:
+		host, from := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_FROM")
+		if host == "" || from == "" {
+			return nil, "", fmt.Errorf("SMTP_HOST and SMTP_FROM must be set")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPEmailSender(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), provider, nil
+	default:
+		return nil, "", fmt.Errorf("unknown EMAIL_PROVIDER %q", provider)
+	}
+}
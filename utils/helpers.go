@@ -4,7 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"net/smtp"
+	"regexp"
+	"strings"
 )
 
 // GenerateUniqueID generates a new unique UUID string.
@@ -12,32 +13,6 @@ func GenerateUniqueID() uuid.UUID {
 	return uuid.New()
 }
 
-func SendEmail(to string, subject string, message string) error {
-	// Define your SMTP server details
-	smtpHost := "smtp.example.com"
-	smtpPort := "587"
-	smtpUser := "your-email@example.com"
-	smtpPass := "your-password"
-
-	// Sender and recipient
-	from := smtpUser
-	recipients := []string{to}
-
-	// Build the email body
-	body := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s", to, subject, message)
-
-	// Authenticate with the SMTP server
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-
-	// Send the email
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, recipients, []byte(body))
-	if err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
-	}
-
-	return nil
-}
-
 // StripeService interface defines the methods for Stripe payment processing
 type StripeService interface {
 	Charge(amount float64, currency, description string) (string, error)
@@ -48,6 +23,18 @@ type MpesaService interface {
 	ProcessExpressPayment(amount float64, phoneNumber, shortcode string) (string, error)
 }
 
+var msisdnPattern = regexp.MustCompile(`^(?:\+?254|0)([17]\d{8})$`)
+
+// NormalizeMSISDN converts a Kenyan mobile number such as 0712345678 or
+// +254712345678 to the 2547XXXXXXXX form the Daraja API expects.
+func NormalizeMSISDN(phoneNumber string) (string, bool) {
+	match := msisdnPattern.FindStringSubmatch(strings.ReplaceAll(phoneNumber, " ", ""))
+	if match == nil {
+		return "", false
+	}
+	return "254" + match[1], true
+}
+
 // MockStripeService is a mock implementation of StripeService
 type MockStripeService struct{}
 
@@ -80,3 +67,23 @@ func NewMockStripeService() StripeService {
 func NewMockMpesaService() MpesaService {
 	return &MockMpesaService{}
 }
+
+// SMSSender delivers text messages such as verification codes.
+type SMSSender interface {
+	SendSMS(phoneNumber, message string) error
+}
+
+// MockSMSSender is a mock implementation of SMSSender
+type MockSMSSender struct{}
+
+func (s *MockSMSSender) SendSMS(phoneNumber, message string) error {
+	// Simulate successful SMS delivery
+	if phoneNumber == "" || message == "" {
+		return errors.New("invalid phone number or message")
+	}
+	return nil
+}
+
+func NewMockSMSSender() SMSSender {
+	return &MockSMSSender{}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestNormalizeMSISDN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"0712345678", "254712345678", true},
+		{"+254712345678", "254712345678", true},
+		{"254712345678", "254712345678", true},
+		{"0112 345 678", "254112345678", true},
+		{"+254 712 345 678", "254712345678", true},
+		{"071234567", "", false},
+		{"+255712345678", "", false},
+		{"0812345678", "", false},
+		{"+1 415 555 2671", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeMSISDN(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeMSISDN(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SMSProviderMock   = "mock"
+	SMSProviderTwilio = "twilio"
+)
+
+const twilioAPIURL = "https://api.twilio.com"
+
+// TwilioSMSSender sends text messages through the Twilio Messages API.
+type TwilioSMSSender struct {
+	client     *http.Client
+	baseURL    string
+	accountSID string
+	authToken  string
+	from       string
+}
+
+// NewTwilioSMSSender returns a sender that posts messages from the given
+// number or messaging service SID.
+func NewTwilioSMSSender(accountSID, authToken, from string) *TwilioSMSSender {
+	return &TwilioSMSSender{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		baseURL:    twilioAPIURL,
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+	}
+}
+
+func (s *TwilioSMSSender) SendSMS(phoneNumber, message string) error {
+	if phoneNumber == "" || message == "" {
+		return fmt.Errorf("invalid phone number or message")
+	}
+
+	form := url.Values{"To": {phoneNumber}, "Body": {message}}
+	if strings.HasPrefix(s.from, "MG") {
+		form.Set("MessagingServiceSid", s.from)
+	} else {
+		form.Set("From", s.from)
+	}
+
+	endpoint := s.baseURL + "/2010-04-01/Accounts/" + url.PathEscape(s.accountSID) + "/Messages.json"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send sms: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("send sms: twilio returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// SMSSenderFromEnv configures the sender named by SMS_PROVIDER. The twilio
+// provider reads TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM. An
+// empty SMS_PROVIDER selects the mock sender, which delivers nothing.
+func SMSSenderFromEnv() (SMSSender, string, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("SMS_PROVIDER")))
+	switch provider {
+	case "", SMSProviderMock:
+		return NewMockSMSSender(), SMSProviderMock, nil
+	case SMSProviderTwilio:
+		accountSID, authToken, from := os.Getenv("TWILIO_ACCOUNT_SID"), os.Getenv("TWILIO_AUTH_TOKEN"), os.Getenv("TWILIO_FROM")
+		if accountSID == "" || authToken == "" || from == "" {
+			return nil, "", fmt.Errorf("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM must be set")
+		}
+		return NewTwilioSMSSender(accountSID, authToken, from), provider, nil
+	default:
+		return nil, "", fmt.Errorf("unknown SMS_PROVIDER %q", provider)
+	}
+}